@@ -0,0 +1,53 @@
+// Command nksh-replay sends the dead letters of an entity back to its input streams.
+//
+//	nksh-replay -kafka kafka -zookeeper zookeeper -label Person
+//
+// It keeps running, and replaying new dead letters, until it receives SIGINT or SIGTERM.
+// Dead letters that failed more than -max-attempts times, e.g. replayed ones that failed
+// again, are dropped.
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/denkhaus/nksh"
+	"github.com/denkhaus/nksh/retry"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/sirupsen/logrus"
+)
+
+// descriptor is the EntityDescriptor of the replayed entity, its context is not queried.
+type descriptor struct {
+	*shared.BaseDescriptor
+}
+
+func (p *descriptor) ContextDef() shared.ContextDefinition {
+	return shared.ContextDefinition{}
+}
+
+func main() {
+	kafkaHost := flag.String("kafka", "kafka", "kafka host")
+	zookeeperHost := flag.String("zookeeper", "zookeeper", "zookeeper host, empty to manage topics through kafka")
+	label := flag.String("label", "", "label of the entity whose dead letters are replayed")
+	maxAttempts := flag.Int("max-attempts", shared.DefaultRetryPolicy().MaxAttempts, "attempts after which a dead letter is dropped")
+	flag.Parse()
+
+	if *label == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	policy := shared.DefaultRetryPolicy()
+	policy.MaxAttempts = *maxAttempts
+
+	descr := &descriptor{shared.NewBaseDescriptor(*label)}
+	descr.SetRetryPolicy(policy)
+	err := nksh.Startup(*kafkaHost, *zookeeperHost,
+		retry.CreateReplayerDefaults(descr),
+	)
+
+	if err != nil {
+		logrus.Fatal(err)
+	}
+}
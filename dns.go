@@ -34,7 +34,11 @@ func DNSLookupIP(host string, retrys int) ([]net.IP, error) {
 }
 
 func LookupClusterHosts(host string, port int, params ...string) ([]string, error) {
-	ips, err := DNSLookupIP(host, 50)
+	return lookupClusterHosts(host, port, DefaultDNSRetries, params...)
+}
+
+func lookupClusterHosts(host string, port int, retrys int, params ...string) ([]string, error) {
+	ips, err := DNSLookupIP(host, retrys)
 	if err != nil {
 		return nil, errors.Annotate(err, "DNSLookupIP")
 	}
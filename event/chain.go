@@ -1,6 +1,7 @@
 package event
 
 import (
+	"github.com/denkhaus/nksh/expr"
 	"github.com/denkhaus/nksh/shared"
 	"github.com/juju/errors"
 	"github.com/lann/builder"
@@ -9,35 +10,95 @@ import (
 
 type ActionData struct {
 	EntityDescriptor shared.EntityDescriptor
+	GraphClient      shared.GraphClient
+	Metrics          shared.Metrics
+	KeyStrategy      shared.KeyStrategy
+	Name             string
+	Scope            string
+	Selector         string
+	TraceFunc        shared.TraceFunc
+	EntityType       shared.EntityType
+	RelType          string
 	Operation        shared.Operation
 	FieldOperation   shared.Operation
 	ErrorHandlers    shared.ErrorHandlers
+	Transactional    bool
 	Then             shared.Handlers
 	Else             shared.Handlers
 	Conditions       shared.EvalFuncs
+	Errors           []error
 	FieldName        string
+	LabelOperation   shared.Operation
+	LabelName        string
+	IgnoreOwnWrites  bool
 	Or               []ActionData
 	And              []ActionData
 	Not              []ActionData
 }
 
 func (p *ActionData) Match(m *shared.EventContext) bool {
-	result := m.Match(
-		p.Operation,
-		p.FieldName,
-		p.FieldOperation,
-		p.Conditions,
-	)
-	for _, data := range p.Or {
-		result = result || data.Match(m)
+	return p.Evaluate(m, nil)
+}
+
+// err returns the first error recorded while building the chain or its branches.
+func (p *ActionData) err() error {
+	if len(p.Errors) > 0 {
+		return p.Errors[0]
 	}
-	for _, data := range p.And {
-		result = result && data.Match(m)
+	for _, branches := range [][]ActionData{p.Or, p.And, p.Not} {
+		for _, data := range branches {
+			if err := data.err(); err != nil {
+				return err
+			}
+		}
 	}
-	for _, data := range p.Not {
-		result = result && !data.Match(m)
+	return nil
+}
+
+// Evaluate matches m like Match and records every evaluated
+// selector, condition and branch in trace, which may be nil.
+func (p *ActionData) Evaluate(m *shared.EventContext, trace *shared.Trace) bool {
+	eval := shared.Evaluation{
+		Selector:   p.Selector,
+		Conditions: p.Conditions,
+		Arg:        *m,
+		Match: func(conditions shared.EvalFuncs) bool {
+			return m.Match(
+				p.EntityType,
+				p.RelType,
+				p.Operation,
+				p.FieldName,
+				p.FieldOperation,
+				p.LabelName,
+				p.LabelOperation,
+				conditions,
+			)
+		},
+		Or:  branches(m, p.Or),
+		And: branches(m, p.And),
+		Not: branches(m, p.Not),
+	}
+
+	result := eval.Evaluate(trace)
+	if p.IgnoreOwnWrites {
+		trace.Add(shared.TraceIgnoreOwnWrites, "", m.OwnWrite)
+		if m.OwnWrite {
+			return trace.Set(false)
+		}
+	}
+	return trace.Set(result)
+}
+
+func branches(m *shared.EventContext, data []ActionData) []shared.Branch {
+	res := make([]shared.Branch, 0, len(data))
+	for idx := range data {
+		d := &data[idx]
+		res = append(res, shared.Branch{
+			Selector: d.Selector,
+			Evaluate: func(trace *shared.Trace) bool { return d.Evaluate(m, trace) },
+		})
 	}
-	return result
+	return res
 }
 
 type chain builder.Builder
@@ -49,13 +110,26 @@ type Selectable interface {
 	OnFieldCreated(field string) Combinable
 	OnFieldUpdated(field string) Combinable
 	OnFieldDeleted(field string) Combinable
+	OnLabelAdded(label string) Combinable
+	OnLabelRemoved(label string) Combinable
+	OnRelationshipCreated(relType string) Combinable
+	OnRelationshipUpdated(relType string) Combinable
+	OnRelationshipDeleted(relType string) Combinable
+	OnRelationshipFieldCreated(relType, field string) Combinable
+	OnRelationshipFieldUpdated(relType, field string) Combinable
+	OnRelationshipFieldDeleted(relType, field string) Combinable
 	With(fn shared.EvalFunc) Combinable
+	WithExpr(src string) Combinable
 }
 
 type Combinable interface {
 	Or(or ...Combinable) Combinable
 	And(or ...Combinable) Combinable
 	Not(not ...Combinable) Combinable
+	IgnoreOwnWrites() Combinable
+	// With adds fn to the conditions of the selector, which are
+	// matched before any Or, And and Not branch.
+	With(fn shared.EvalFunc) Combinable
 }
 
 type Catchable interface {
@@ -63,8 +137,18 @@ type Catchable interface {
 }
 
 type Executable interface {
+	Transactional() Executable
 	Execute(ctx goka.Context, m *shared.EventContext) shared.ChainHandledState
+	Run(ctx goka.Context, m *shared.EventContext) (shared.ChainHandledState, error)
 	SetDescriptor(descr shared.EntityDescriptor) Executable
+	SetGraphClient(client shared.GraphClient) Executable
+	Named(name string) Executable
+	Name() string
+	Scoped(label string) Executable
+	Scope() string
+	Trace(fn shared.TraceFunc) Executable
+	Explain(m *shared.EventContext) *shared.Trace
+	Err() error
 }
 
 type Proceedable interface {
@@ -76,34 +160,89 @@ type Alternative interface {
 	Catch(fn shared.ErrorHandler) Executable
 }
 
+func (b chain) onNode(name string, args ...string) interface{} {
+	c := builder.Set(b, "Selector", shared.Selector(name, args...))
+	return builder.Set(c, "EntityType", shared.NodeEntity)
+}
+
+func (b chain) onRelationship(relType, name string, args ...string) interface{} {
+	c := builder.Set(b, "Selector", shared.Selector(name, args...))
+	c = builder.Set(c, "EntityType", shared.RelationshipEntity)
+	return builder.Set(c, "RelType", relType)
+}
+
 func (b chain) OnNodeCreated() Combinable {
-	return builder.Set(b, "Operation", "created").(Combinable)
+	return builder.Set(b.onNode("OnNodeCreated"), "Operation", shared.CreatedOperation).(Combinable)
 }
 
 func (b chain) OnNodeUpdated() Combinable {
-	c := builder.Set(b, "Operation", shared.UpdatedOperation)
+	c := builder.Set(b.onNode("OnNodeUpdated"), "Operation", shared.UpdatedOperation)
 	c = builder.Set(c, "FieldOperation", shared.UpdatedOperation)
 	return builder.Set(c, "FieldName", "*").(Combinable)
 }
 
 func (b chain) OnNodeDeleted() Combinable {
-	return builder.Set(b, "Operation", shared.DeletedOperation).(Combinable)
+	return builder.Set(b.onNode("OnNodeDeleted"), "Operation", shared.DeletedOperation).(Combinable)
 }
 
 func (b chain) OnFieldCreated(field string) Combinable {
-	c := builder.Set(b, "Operation", shared.UpdatedOperation)
+	c := builder.Set(b.onNode("OnFieldCreated", field), "Operation", shared.UpdatedOperation)
 	c = builder.Set(c, "FieldOperation", shared.CreatedOperation)
 	return builder.Set(c, "FieldName", field).(Combinable)
 }
 
 func (b chain) OnFieldUpdated(field string) Combinable {
-	c := builder.Set(b, "Operation", shared.UpdatedOperation)
+	c := builder.Set(b.onNode("OnFieldUpdated", field), "Operation", shared.UpdatedOperation)
 	c = builder.Set(c, "FieldOperation", shared.UpdatedOperation)
 	return builder.Set(c, "FieldName", field).(Combinable)
 }
 
 func (b chain) OnFieldDeleted(field string) Combinable {
-	c := builder.Set(b, "Operation", shared.UpdatedOperation)
+	c := builder.Set(b.onNode("OnFieldDeleted", field), "Operation", shared.UpdatedOperation)
+	c = builder.Set(c, "FieldOperation", shared.DeletedOperation)
+	return builder.Set(c, "FieldName", field).(Combinable)
+}
+
+func (b chain) OnLabelAdded(label string) Combinable {
+	c := builder.Set(b.onNode("OnLabelAdded", label), "Operation", shared.UpdatedOperation)
+	c = builder.Set(c, "LabelOperation", shared.CreatedOperation)
+	return builder.Set(c, "LabelName", label).(Combinable)
+}
+
+func (b chain) OnLabelRemoved(label string) Combinable {
+	c := builder.Set(b.onNode("OnLabelRemoved", label), "Operation", shared.UpdatedOperation)
+	c = builder.Set(c, "LabelOperation", shared.DeletedOperation)
+	return builder.Set(c, "LabelName", label).(Combinable)
+}
+
+func (b chain) OnRelationshipCreated(relType string) Combinable {
+	return builder.Set(b.onRelationship(relType, "OnRelationshipCreated", relType), "Operation", shared.CreatedOperation).(Combinable)
+}
+
+func (b chain) OnRelationshipUpdated(relType string) Combinable {
+	c := builder.Set(b.onRelationship(relType, "OnRelationshipUpdated", relType), "Operation", shared.UpdatedOperation)
+	c = builder.Set(c, "FieldOperation", shared.UpdatedOperation)
+	return builder.Set(c, "FieldName", "*").(Combinable)
+}
+
+func (b chain) OnRelationshipDeleted(relType string) Combinable {
+	return builder.Set(b.onRelationship(relType, "OnRelationshipDeleted", relType), "Operation", shared.DeletedOperation).(Combinable)
+}
+
+func (b chain) OnRelationshipFieldCreated(relType, field string) Combinable {
+	c := builder.Set(b.onRelationship(relType, "OnRelationshipFieldCreated", relType, field), "Operation", shared.UpdatedOperation)
+	c = builder.Set(c, "FieldOperation", shared.CreatedOperation)
+	return builder.Set(c, "FieldName", field).(Combinable)
+}
+
+func (b chain) OnRelationshipFieldUpdated(relType, field string) Combinable {
+	c := builder.Set(b.onRelationship(relType, "OnRelationshipFieldUpdated", relType, field), "Operation", shared.UpdatedOperation)
+	c = builder.Set(c, "FieldOperation", shared.UpdatedOperation)
+	return builder.Set(c, "FieldName", field).(Combinable)
+}
+
+func (b chain) OnRelationshipFieldDeleted(relType, field string) Combinable {
+	c := builder.Set(b.onRelationship(relType, "OnRelationshipFieldDeleted", relType, field), "Operation", shared.UpdatedOperation)
 	c = builder.Set(c, "FieldOperation", shared.DeletedOperation)
 	return builder.Set(c, "FieldName", field).(Combinable)
 }
@@ -132,10 +271,30 @@ func (b chain) Not(not ...Combinable) Combinable {
 	return builder.Append(b, "Not", data...).(Combinable)
 }
 
+func (b chain) IgnoreOwnWrites() Combinable {
+	return builder.Set(b, "IgnoreOwnWrites", true).(Combinable)
+}
+
 func (b chain) With(fn shared.EvalFunc) Combinable {
 	return builder.Append(b, "Conditions", fn).(Combinable)
 }
 
+// WithExpr adds the expression src as condition, see package expr.
+// If src does not compile the condition never matches, Err and Run return the compile error.
+func (b chain) WithExpr(src string) Combinable {
+	prog, err := expr.Compile(src, expr.EventEnv)
+	if err != nil {
+		b = builder.Append(b, "Errors", errors.Annotatef(err, "WithExpr [%s]", src)).(chain)
+		return b.With(func(arg interface{}) bool { return false })
+	}
+	return b.With(prog.Eval)
+}
+
+// Transactional runs the handlers of the chain in a single Neo4j transaction.
+func (b chain) Transactional() Executable {
+	return builder.Set(b, "Transactional", true).(Executable)
+}
+
 func (b chain) Catch(fn shared.ErrorHandler) Executable {
 	return builder.Append(b, "ErrorHandlers", fn).(Executable)
 }
@@ -160,7 +319,56 @@ func (b chain) SetDescriptor(descr shared.EntityDescriptor) Executable {
 	return builder.Set(b, "EntityDescriptor", descr).(Executable)
 }
 
-func (b chain) handleError(err error) {
+// SetGraphClient sets the GraphClient the handlers of the chain run their cypher with.
+func (b chain) SetGraphClient(client shared.GraphClient) Executable {
+	return builder.Set(b, "GraphClient", client).(Executable)
+}
+
+// Named names the chain in logs, metrics and traces.
+func (b chain) Named(name string) Executable {
+	return builder.Set(b, "Name", name).(Executable)
+}
+
+func (b chain) Name() string {
+	if name, ok := builder.Get(b, "Name"); ok {
+		return name.(string)
+	}
+	return ""
+}
+
+// Scoped runs the chain only in the consumers of the descriptor with label
+// when it is part of a ChainSet.
+func (b chain) Scoped(label string) Executable {
+	return builder.Set(b, "Scope", label).(Executable)
+}
+
+func (b chain) Scope() string {
+	if scope, ok := builder.Get(b, "Scope"); ok {
+		return scope.(string)
+	}
+	return ""
+}
+
+// Trace passes the evaluation tree of every message the chain runs on to fn.
+func (b chain) Trace(fn shared.TraceFunc) Executable {
+	return builder.Set(b, "TraceFunc", fn).(Executable)
+}
+
+// Explain evaluates the chain for m without running any handler.
+func (b chain) Explain(m *shared.EventContext) *shared.Trace {
+	data := builder.GetStruct(b).(ActionData)
+	trace := shared.NewTrace(shared.TraceChain, data.Name)
+	data.Evaluate(m, trace)
+	return trace
+}
+
+// Err returns the first error recorded while building the chain, e.g. by WithExpr.
+func (b chain) Err() error {
+	data := builder.GetStruct(b).(ActionData)
+	return data.err()
+}
+
+func (b chain) handleError(err error) error {
 	if ehs, ok := builder.Get(b, "ErrorHandlers"); ok {
 		handlers := ehs.(shared.ErrorHandlers)
 		for _, handle := range handlers {
@@ -169,44 +377,66 @@ func (b chain) handleError(err error) {
 	} else {
 		panic(errors.Annotate(err, "EventChain: no catch handler found"))
 	}
+
+	return err
 }
 
 func (b chain) Execute(ctx goka.Context, m *shared.EventContext) shared.ChainHandledState {
+	state, _ := b.Run(ctx, m)
+	return state
+}
+
+// Run executes the chain like Execute and additionally returns the handled error.
+func (b chain) Run(ctx goka.Context, m *shared.EventContext) (shared.ChainHandledState, error) {
 	data := builder.GetStruct(b).(ActionData)
 	if len(data.Then) == 0 {
-		b.handleError(errors.New("EventChain: no handler defined"))
-		return shared.ChainHandledStateThenFailed
+		return shared.ChainHandledStateThenFailed,
+			b.handleError(errors.New("EventChain: no handler defined"))
+	}
+	if err := data.err(); err != nil {
+		return shared.ChainHandledStateThenFailed,
+			b.handleError(errors.Annotate(err, "EventChain: invalid chain"))
 	}
 
 	hCtx := shared.HandlerContext{
 		GokaContext:      ctx,
 		EntityDescriptor: data.EntityDescriptor,
+		GraphClient:      data.GraphClient,
+		Metrics:          data.Metrics,
+		KeyStrategy:      data.KeyStrategy,
+		Chain:            data.Name,
 		EventContext:     m,
 	}
 
-	if data.Match(m) {
-		for _, handle := range data.Then {
-			if err := handle(&hCtx); err != nil {
+	var trace *shared.Trace
+	if data.TraceFunc != nil {
+		trace = shared.NewTrace(shared.TraceChain, data.Name)
+	}
+
+	matched := data.Evaluate(m, trace)
+	if trace != nil {
+		data.TraceFunc(trace)
+	}
+
+	if matched {
+		if err := shared.ExecuteHandlers(&hCtx, data.Then, data.Transactional); err != nil {
+			return shared.ChainHandledStateThenFailed,
 				b.handleError(errors.Annotate(err, "HandleEvent [then]"))
-				return shared.ChainHandledStateThenFailed
-			}
 		}
 
-		return shared.ChainHandledStateThen
+		return shared.ChainHandledStateThen, nil
 	}
 
 	if len(data.Else) == 0 {
-		return shared.ChainHandledStateUnhandled
+		return shared.ChainHandledStateUnhandled, nil
 	}
 
-	for _, handle := range data.Else {
-		if err := handle(&hCtx); err != nil {
+	if err := shared.ExecuteHandlers(&hCtx, data.Else, data.Transactional); err != nil {
+		return shared.ChainHandledStateElseFailed,
 			b.handleError(errors.Annotate(err, "HandleEvent [else]"))
-			return shared.ChainHandledStateElseFailed
-		}
 	}
 
-	return shared.ChainHandledStateElse
+	return shared.ChainHandledStateElse, nil
 }
 
 var actionChain = builder.Register(chain{}, ActionData{})
@@ -232,3 +462,33 @@ func OnFieldUpdated(field string) Combinable {
 func OnFieldDeleted(field string) Combinable {
 	return actionChain.(Selectable).OnFieldDeleted(field)
 }
+func OnLabelAdded(label string) Combinable {
+	return actionChain.(Selectable).OnLabelAdded(label)
+}
+func OnLabelRemoved(label string) Combinable {
+	return actionChain.(Selectable).OnLabelRemoved(label)
+}
+func OnRelationshipCreated(relType string) Combinable {
+	return actionChain.(Selectable).OnRelationshipCreated(relType)
+}
+func OnRelationshipUpdated(relType string) Combinable {
+	return actionChain.(Selectable).OnRelationshipUpdated(relType)
+}
+func OnRelationshipDeleted(relType string) Combinable {
+	return actionChain.(Selectable).OnRelationshipDeleted(relType)
+}
+func OnRelationshipFieldCreated(relType, field string) Combinable {
+	return actionChain.(Selectable).OnRelationshipFieldCreated(relType, field)
+}
+func OnRelationshipFieldUpdated(relType, field string) Combinable {
+	return actionChain.(Selectable).OnRelationshipFieldUpdated(relType, field)
+}
+func OnRelationshipFieldDeleted(relType, field string) Combinable {
+	return actionChain.(Selectable).OnRelationshipFieldDeleted(relType, field)
+}
+func With(fn shared.EvalFunc) Combinable {
+	return actionChain.(Selectable).With(fn)
+}
+func WithExpr(src string) Combinable {
+	return actionChain.(Selectable).WithExpr(src)
+}
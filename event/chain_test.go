@@ -84,3 +84,215 @@ func TestChain(t *testing.T) {
 	assert.Equal(t, 0, elseTriggered, "else triggered")
 	assert.Equal(t, shared.ChainHandledStateThen, state, "condition hit")
 }
+
+var relationshipCreate = `
+{
+	"meta": {
+	  "timestamp": 1532597182604,
+	  "username": "neo4j",
+	  "tx_id": 4,
+	  "tx_event_id": 0,
+	  "tx_events_count": 1,
+	  "operation": "created",
+	  "source": {
+		"hostname": "neo4j.mycompany.com"
+	  }
+	},
+	"payload": {
+	  "id": "123",
+	  "type": "relationship",
+	  "label": "HAS_PHOTO",
+	  "start": {
+		"labels": ["Person"],
+		"id": "1004"
+	  },
+	  "end": {
+		"labels": ["Photo"],
+		"id": "2336"
+	  },
+	  "after": {
+		"properties": {
+		  "since": 2018
+		}
+	  }
+	}
+  }
+`
+
+func TestRelationshipChain(t *testing.T) {
+	codec := Neo4jMessageCodec{}
+	m, err := codec.Decode([]byte(relationshipCreate))
+	assert.NoError(t, err, "decode raw message")
+
+	ctx, err := m.(*Neo4jMessage).ToContext()
+	assert.NoError(t, err, "create context")
+	assert.Equal(t, shared.RelationshipEntity, ctx.EntityType(), "entity type")
+	assert.Equal(t, int64(1004), ctx.Relationship.StartID, "start id")
+	assert.Equal(t, []string{"Photo"}, ctx.Relationship.EndLabels, "end labels")
+
+	var handledError error
+	thenTriggered := 0
+
+	condition := If(
+		OnRelationshipCreated("HAS_PHOTO").Or(
+			OnRelationshipFieldCreated("KNOWS", "since"),
+		).Not(
+			OnNodeCreated(),
+		),
+	).Then(func(_ *shared.HandlerContext) error {
+		thenTriggered++
+		return nil
+	}).Catch(func(err error) {
+		handledError = err
+	})
+
+	state := condition.Execute(nil, ctx)
+	assert.NoError(t, handledError, "handled error")
+	assert.Equal(t, 1, thenTriggered, "then triggered")
+	assert.Equal(t, shared.ChainHandledStateThen, state, "condition hit")
+
+	state = If(OnRelationshipDeleted("HAS_PHOTO")).Then(
+		func(_ *shared.HandlerContext) error {
+			return nil
+		}).Catch(func(err error) {
+		handledError = err
+	}).Execute(nil, ctx)
+	assert.Equal(t, shared.ChainHandledStateUnhandled, state, "condition missed")
+}
+
+func TestLabelChain(t *testing.T) {
+	codec := Neo4jMessageCodec{}
+	m, err := codec.Decode([]byte(update))
+	assert.NoError(t, err, "decode raw message")
+
+	ctx, err := m.(*Neo4jMessage).ToContext()
+	assert.NoError(t, err, "create context")
+	assert.Equal(t, []string{"Person"}, ctx.Labels, "labels")
+
+	var handledError error
+	thenTriggered := 0
+
+	condition := If(
+		OnLabelRemoved("Tmp").And(
+			OnFieldUpdated("first_name"),
+		).Not(
+			OnLabelAdded("*"),
+			OnLabelRemoved("Person"),
+		),
+	).Then(func(_ *shared.HandlerContext) error {
+		thenTriggered++
+		return nil
+	}).Catch(func(err error) {
+		handledError = err
+	})
+
+	state := condition.Execute(nil, ctx)
+	assert.NoError(t, handledError, "handled error")
+	assert.Equal(t, 1, thenTriggered, "then triggered")
+	assert.Equal(t, shared.ChainHandledStateThen, state, "condition hit")
+}
+
+func TestIgnoreOwnWrites(t *testing.T) {
+	ctx := &shared.EventContext{
+		Operation:  shared.UpdatedOperation,
+		Labels:     []string{"Person"},
+		Properties: shared.Properties{},
+		ChangeInfos: shared.ChangeInfos{
+			"visible": shared.ChangeInfo{Before: true, After: false},
+			shared.OwnWriteProperty: shared.ChangeInfo{
+				Before: "abcd", After: "efgh",
+			},
+		},
+	}
+	ctx.OwnWrite = ctx.IsOwnWrite()
+	assert.True(t, ctx.OwnWrite, "own write")
+
+	var handledError error
+	handler := func(_ *shared.HandlerContext) error {
+		return nil
+	}
+
+	state := If(OnFieldUpdated("visible")).Then(handler).Catch(func(err error) {
+		handledError = err
+	}).Execute(nil, ctx)
+	assert.Equal(t, shared.ChainHandledStateThen, state, "condition hit")
+
+	state = If(OnFieldUpdated("visible").IgnoreOwnWrites()).Then(handler).Catch(func(err error) {
+		handledError = err
+	}).Execute(nil, ctx)
+	assert.NoError(t, handledError, "handled error")
+	assert.Equal(t, shared.ChainHandledStateUnhandled, state, "own write ignored")
+}
+
+func TestExplain(t *testing.T) {
+	m, err := new(Neo4jMessageCodec).Decode([]byte(update))
+	assert.NoError(t, err, "decode raw message")
+
+	ctx, err := m.(*Neo4jMessage).ToContext()
+	assert.NoError(t, err, "create context")
+
+	var traces []*shared.Trace
+	chain := If(
+		OnNodeUpdated().And(
+			OnFieldUpdated("first_name"),
+			OnFieldUpdated("email"),
+		),
+	).Then(func(_ *shared.HandlerContext) error {
+		return nil
+	}).Catch(func(err error) {
+		assert.NoError(t, err, "handled error")
+	}).Named("rename").Trace(func(trace *shared.Trace) {
+		traces = append(traces, trace)
+	})
+
+	assert.Equal(t, "rename", chain.Name())
+
+	trace := chain.Explain(ctx)
+	assert.False(t, trace.Result, "chain result")
+	assert.Equal(t, `chain rename: false
+  selector OnNodeUpdated: true
+  and OnFieldUpdated(first_name): true
+    selector OnFieldUpdated(first_name): true
+  and OnFieldUpdated(email): false
+    selector OnFieldUpdated(email): false
+`, trace.String())
+
+	state := chain.Execute(nil, ctx)
+	assert.Equal(t, shared.ChainHandledStateUnhandled, state, "condition missed")
+	if assert.Len(t, traces, 1, "traced runs") {
+		assert.Equal(t, trace, traces[0])
+	}
+}
+
+func TestWithExpr(t *testing.T) {
+	ctx := &shared.EventContext{
+		Operation:  shared.UpdatedOperation,
+		Labels:     []string{"Person"},
+		Properties: shared.Properties{"zip": "12345"},
+		ChangeInfos: shared.ChangeInfos{
+			"zip": shared.ChangeInfo{Before: "1234", After: "12345"},
+		},
+	}
+
+	handler := func(_ *shared.HandlerContext) error {
+		return nil
+	}
+
+	var handledError error
+	chain := If(OnNodeUpdated().And(WithExpr(`matches(props.zip, "^\d{5}$")`))).Then(handler).Catch(func(err error) {
+		handledError = err
+	})
+	assert.NoError(t, chain.Err())
+	assert.Equal(t, shared.ChainHandledStateThen, chain.Execute(nil, ctx), "condition hit")
+	assert.NoError(t, handledError, "handled error")
+
+	chain = If(OnNodeUpdated().And(WithExpr(`props.zip ==`))).Then(handler).Catch(func(err error) {
+		handledError = err
+	})
+	assert.EqualError(t, chain.Err(), "WithExpr [props.zip ==]: col 13: unexpected end of expression")
+
+	state, err := chain.Run(nil, ctx)
+	assert.Equal(t, shared.ChainHandledStateThenFailed, state, "invalid chain")
+	assert.EqualError(t, err, "EventChain: invalid chain: WithExpr [props.zip ==]: col 13: unexpected end of expression")
+	assert.Equal(t, err, handledError, "handled error")
+}
@@ -0,0 +1,16 @@
+package event
+
+import (
+	"github.com/denkhaus/nksh/shared"
+)
+
+// ChainSet holds the chains of running consumers, see shared.ChainSet.
+type ChainSet = shared.ChainSet
+
+func NewChainSet(execs ...Executable) *ChainSet {
+	chains := make([]interface{}, 0, len(execs))
+	for _, exe := range execs {
+		chains = append(chains, exe)
+	}
+	return shared.NewChainSet(chains...)
+}
@@ -0,0 +1,57 @@
+package event
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/denkhaus/nksh/graphtest"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/lovoo/goka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleInputEvents(t *testing.T) {
+	descr := graphtest.NewDescriptor("Person")
+	descr.SetRetryPolicy(shared.DefaultRetryPolicy())
+
+	ran := []string{}
+	chain := func(name string, err error) Executable {
+		return If(OnNodeCreated()).
+			Then(func(ctx *shared.HandlerContext) error {
+				ran = append(ran, ctx.Chain)
+				return err
+			}).
+			Catch(func(err error) {}).
+			Named(name)
+	}
+	execs := []Executable{
+		chain("first", nil),
+		chain("failing", shared.Retryable(errors.New("busy"))),
+		chain("last", nil),
+	}
+
+	ctx := graphtest.NewContext(descr.EventInputStream(), "Person-1004")
+	m := &shared.EventContext{NodeID: 1004, Operation: shared.CreatedOperation}
+	assert.NoError(t, handleInputEvents(ctx, m, descr, graphtest.NewMetrics(), execs...))
+	assert.Equal(t, []string{"first", "failing", "last"}, ran, "later chains run")
+	assert.Equal(t, []goka.Stream{descr.RetryStream()}, ctx.Streams())
+
+	failed := ctx.Emits[0].Value.(*shared.FailedMessage)
+	assert.Equal(t, "failing", failed.Chain)
+	assert.Equal(t, 1, failed.Attempt)
+	assert.Equal(t, "", m.Chain, "message unchanged")
+
+	var retried shared.EventContext
+	assert.NoError(t, json.Unmarshal(failed.Payload, &retried))
+	assert.Equal(t, "failing", retried.Chain)
+	assert.Equal(t, 1, retried.Attempt)
+
+	ran = []string{}
+	ctx = graphtest.NewContext(descr.EventInputStream(), "Person-1004")
+	assert.NoError(t, handleInputEvents(ctx, &retried, descr, graphtest.NewMetrics(), execs...))
+	assert.Equal(t, []string{"failing"}, ran, "retried chain only")
+	if assert.Len(t, ctx.Emits, 1) {
+		assert.Equal(t, 2, ctx.Emits[0].Value.(*shared.FailedMessage).Attempt)
+	}
+}
@@ -0,0 +1,42 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/denkhaus/nksh/graphtest"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifySuperOrdinates(t *testing.T) {
+	client := graphtest.NewClient()
+	client.OnQuery("MATCH (super)-[]->(p)").Return(
+		graphtest.NewRecord(map[string]interface{}{
+			"id":     int64(7),
+			"labels": []interface{}{"PersonConnector"},
+		}),
+	)
+
+	ctx := graphtest.NewContext("Input2Person", "Person-1004")
+	hCtx := shared.HandlerContext{
+		GokaContext:      ctx,
+		GraphClient:      client,
+		EntityDescriptor: graphtest.NewDescriptor("Person"),
+		EventContext:     &shared.EventContext{NodeID: 1004},
+	}
+
+	assert.NoError(t, NotifySuperOrdinates()(&hCtx), "notify superordinates")
+	client.AssertExecuted(t, "MATCH (super)-[]->(p) WHERE id(p) = $id", map[string]interface{}{
+		"id": int64(1004),
+	})
+	assert.Equal(t, 0, client.OpenSessions(), "open sessions")
+
+	assert.Len(t, ctx.Emits, 1, "notified superordinates")
+	assert.Equal(t, shared.HubStream, ctx.Emits[0].Stream, "hub stream")
+
+	msg, ok := ctx.Emits[0].Value.(*shared.HubContext)
+	assert.True(t, ok, "notification type")
+	assert.Equal(t, "PersonConnector", msg.Receiver, "receiver")
+	assert.Equal(t, int64(7), msg.ReceiverID, "receiver id")
+	assert.Equal(t, "Person", msg.Sender, "sender")
+}
@@ -24,6 +24,11 @@ type Neo4jSource struct {
 	Hostname string `json:"hostname"`
 }
 
+var (
+	Neo4jNodeType         = "node"
+	Neo4jRelationshipType = "relationship"
+)
+
 type Neo4jPayload struct {
 	ID       string              `json:"id"`
 	Type     string              `json:"type"`
@@ -49,16 +54,85 @@ type Neo4jMessage struct {
 	Payload Neo4jPayload `json:"payload"`
 }
 
+// Labels returns the distinct node labels of the before and after state.
+func (p *Neo4jMessage) Labels() []string {
+	labels := []string{}
+	seen := map[string]bool{}
+	for _, state := range []*Neo4jBeforeOrAfter{
+		p.Payload.Before,
+		p.Payload.After,
+	} {
+		if state == nil {
+			continue
+		}
+		for _, label := range state.Labels {
+			if !seen[label] {
+				seen[label] = true
+				labels = append(labels, label)
+			}
+		}
+	}
+
+	return labels
+}
+
+func (p *Neo4jMessage) relationshipInfo() (*shared.RelationshipInfo, error) {
+	if p.Payload.Start == nil || p.Payload.End == nil {
+		return nil, errors.New("payload start or end undefined")
+	}
+
+	startID, err := strconv.ParseInt(p.Payload.Start.ID, 10, 64)
+	if err != nil {
+		return nil, errors.Annotate(err, "ParseInt [start id]")
+	}
+
+	endID, err := strconv.ParseInt(p.Payload.End.ID, 10, 64)
+	if err != nil {
+		return nil, errors.Annotate(err, "ParseInt [end id]")
+	}
+
+	rel := shared.RelationshipInfo{
+		Type:        p.Payload.RelLabel,
+		StartID:     startID,
+		StartLabels: p.Payload.Start.Labels,
+		EndID:       endID,
+		EndLabels:   p.Payload.End.Labels,
+	}
+
+	return &rel, nil
+}
+
 func (p *Neo4jMessage) ToContext() (*shared.EventContext, error) {
+	switch p.Meta.Operation {
+	case shared.DeletedOperation:
+		if p.Payload.Before == nil {
+			return nil, errors.New("payload before state undefined")
+		}
+	case shared.CreatedOperation:
+		if p.Payload.After == nil {
+			return nil, errors.New("payload after state undefined")
+		}
+	case shared.UpdatedOperation:
+		if p.Payload.Before == nil || p.Payload.After == nil {
+			return nil, errors.New("payload before or after state undefined")
+		}
+	default:
+		return nil, errors.Errorf("invalid operation %q", p.Meta.Operation)
+	}
+
 	id, err := strconv.ParseInt(p.Payload.ID, 10, 64)
 	if err != nil {
 		return nil, errors.Annotate(err, "ParseInt [id]")
 	}
 
 	n := shared.EventContext{
-		NodeID:      id,
-		ChangeInfos: make(shared.ChangeInfos),
-		Operation:   p.Meta.Operation,
+		NodeID:        id,
+		ChangeInfos:   make(shared.ChangeInfos),
+		LabelChanges:  make(shared.ChangeInfos),
+		Operation:     p.Meta.Operation,
+		TxID:          int64(p.Meta.TxID),
+		TxEventID:     p.Meta.TxEventID,
+		TxEventsCount: p.Meta.TxEventsCount,
 		TimeStamp: time.Unix(0,
 			p.Meta.Timestamp*int64(time.Millisecond),
 		),
@@ -66,15 +140,27 @@ func (p *Neo4jMessage) ToContext() (*shared.EventContext, error) {
 
 	switch p.Meta.Operation {
 	case shared.DeletedOperation:
+		n.Labels = p.Payload.Before.Labels
 		n.Properties = p.Payload.Before.Properties
 		n.BuildChanges(true, p.Payload.Before.Properties)
 	case shared.CreatedOperation:
+		n.Labels = p.Payload.After.Labels
 		n.Properties = p.Payload.After.Properties
 		n.BuildChanges(false, p.Payload.After.Properties)
 	case shared.UpdatedOperation:
+		n.Labels = p.Payload.After.Labels
 		n.Properties = p.Payload.After.Properties
 		n.BuildChanges(false, p.Payload.After.Properties)
 		n.BuildChanges(true, p.Payload.Before.Properties)
+		n.BuildLabelChanges(p.Payload.Before.Labels, p.Payload.After.Labels)
+	}
+
+	if p.Payload.Type == Neo4jRelationshipType {
+		rel, err := p.relationshipInfo()
+		if err != nil {
+			return nil, errors.Annotate(err, "relationshipInfo")
+		}
+		n.Relationship = rel
 	}
 
 	// remove unchanged properties
@@ -84,6 +170,8 @@ func (p *Neo4jMessage) ToContext() (*shared.EventContext, error) {
 		}
 	}
 
+	n.OwnWrite = n.IsOwnWrite()
+
 	return &n, nil
 }
 
@@ -0,0 +1,125 @@
+package event
+
+import (
+	"context"
+
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+)
+
+type routes map[string]goka.Stream
+
+func newRoutes(descrs ...shared.EntityDescriptor) routes {
+	r := make(routes)
+	for _, descr := range descrs {
+		r[descr.Label()] = descr.EventInputStream()
+	}
+
+	return r
+}
+
+func handleNeo4jMessages(ctx goka.Context, msg interface{}, r routes, keys shared.KeyStrategy, errorStream goka.Stream, metrics shared.Metrics) error {
+	data, ok := msg.([]byte)
+	if !ok {
+		metrics.DecodeFailed("", ctx.Topic())
+		return errors.Errorf("invalid message type %+v", msg)
+	}
+
+	reportError := func(err error) error {
+		metrics.DecodeFailed("", ctx.Topic())
+		if errorStream != "" {
+			ctx.Emit(errorStream, ctx.Key(), data)
+		}
+		return err
+	}
+
+	m, err := new(Neo4jMessageCodec).Decode(data)
+	if err != nil {
+		return reportError(errors.Annotate(err, "Decode"))
+	}
+
+	neoMsg := m.(*Neo4jMessage)
+	eventCtx, err := neoMsg.ToContext()
+	if err != nil {
+		return reportError(errors.Annotate(err, "ToContext"))
+	}
+
+	routed := map[goka.Stream]bool{}
+	route := func(labels []string, id int64) {
+		for _, label := range labels {
+			if stream, ok := r[label]; ok && !routed[stream] {
+				ctx.Emit(stream, keys.Key(label, id), eventCtx)
+				routed[stream] = true
+			}
+		}
+	}
+
+	if rel := eventCtx.Relationship; rel != nil {
+		route(rel.StartLabels, rel.StartID)
+		route(rel.EndLabels, rel.EndID)
+	} else {
+		route(neoMsg.Labels(), eventCtx.NodeID)
+	}
+
+	if len(routed) == 0 {
+		log.Debugf("no route for neo4j msg %s", neoMsg.Payload.ID)
+	}
+
+	return nil
+}
+
+// receives raw neo4j streams messages, sends input messages
+func CreateTranslatorDefaults(inputStream goka.Stream, descrs ...shared.EntityDescriptor) shared.DispatcherFunc {
+	return CreateTranslator(shared.InputGroup, inputStream, "", descrs...)
+}
+
+// CreateTranslator translates Neo4jMessages into EventContexts and routes them by node label
+// to the EventInputStream of the matching descriptor. Relationship events are routed by the
+// labels of their start and end node. Undecodable messages are logged and,
+// if errorStream is not empty, forwarded unaltered to errorStream.
+func CreateTranslator(group goka.Group, inputStream, errorStream goka.Stream, descrs ...shared.EntityDescriptor) shared.DispatcherFunc {
+	return func(ctx context.Context, kServers, zServers []string) func() error {
+		health := shared.RegisterProcessor(ctx, group)
+		return func() error {
+			r := newRoutes(descrs...)
+			keys := shared.KeyStrategyFromContext(ctx)
+			metrics := shared.MetricsFromContext(ctx)
+			edges := []goka.Edge{
+				goka.Input(inputStream, new(codec.Bytes), func(ctx goka.Context, msg interface{}) {
+					metrics.MessageConsumed("", inputStream)
+					if err := handleNeo4jMessages(ctx, msg, r, keys, errorStream, metrics); err != nil {
+						log.Error(errors.Annotate(err, "handleNeo4jMessages"))
+					}
+				}),
+			}
+
+			for _, stream := range r {
+				edges = append(edges, goka.Output(stream, new(shared.EventContextCodec)))
+			}
+
+			if errorStream != "" {
+				edges = append(edges, goka.Output(errorStream, new(codec.Bytes)))
+			}
+
+			g := goka.DefineGroup(group, edges...)
+			p, err := goka.NewProcessor(kServers, g,
+				shared.ProcessorOptions(ctx,
+					goka.WithTopicManagerBuilder(
+						shared.TopicManagerBuilder(ctx, zServers),
+					),
+				)...,
+			)
+			if err != nil {
+				return errors.Annotate(err, "NewProcessor")
+			}
+
+			if err := shared.RunProcessor(ctx, health, p); err != nil {
+				return errors.Annotate(err, "RunProcessor")
+			}
+
+			return nil
+		}
+	}
+}
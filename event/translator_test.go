@@ -0,0 +1,43 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/denkhaus/nksh/graphtest"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/lovoo/goka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslator(t *testing.T) {
+	r := newRoutes(
+		graphtest.NewDescriptor("Person"),
+		graphtest.NewDescriptor("Photo"),
+	)
+
+	metrics := graphtest.NewMetrics()
+	ctx := graphtest.NewContext("Neo4jMessages", "key")
+	err := handleNeo4jMessages(ctx, []byte(update), r, shared.NodeAffineKeys, "Errors", metrics)
+	assert.NoError(t, err, "handle valid message")
+	assert.Len(t, ctx.Emits, 1, "routed messages")
+	assert.Equal(t, goka.Stream("Input2Person"), ctx.Emits[0].Stream, "routed stream")
+	assert.Equal(t, "Person-1004", ctx.Emits[0].Key, "routed key")
+
+	evt, ok := ctx.Emits[0].Value.(*shared.EventContext)
+	assert.True(t, ok, "routed value type")
+	assert.Equal(t, int64(1004), evt.NodeID, "routed node id")
+
+	assert.Equal(t, 0, metrics.Count("DecodeFailed"), "decode failures")
+
+	ctx = graphtest.NewContext("Neo4jMessages", "key")
+	err = handleNeo4jMessages(ctx, []byte(update), routes{}, shared.NodeAffineKeys, "Errors", metrics)
+	assert.NoError(t, err, "handle unroutable message")
+	assert.Equal(t, 0, metrics.Count("DecodeFailed"), "decode failures")
+
+	ctx = graphtest.NewContext("Neo4jMessages", "key")
+	err = handleNeo4jMessages(ctx, []byte(`{"meta":`), r, shared.NodeAffineKeys, "Errors", metrics)
+	assert.Error(t, err, "handle invalid message")
+	assert.Len(t, ctx.Emits, 1, "reported messages")
+	assert.Equal(t, goka.Stream("Errors"), ctx.Emits[0].Stream, "error stream")
+	assert.Equal(t, 1, metrics.Count("DecodeFailed"), "decode failures")
+}
@@ -0,0 +1,530 @@
+package expr
+
+import (
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/denkhaus/nksh/predicate"
+	"github.com/denkhaus/nksh/shared"
+)
+
+// node is an expression, pos is the offset in runes its source starts at.
+type node interface {
+	pos() int
+	check(env *Env) (Type, error)
+	eval(arg interface{}) (interface{}, error)
+}
+
+// accepts reports whether a value of type typ may be used where one of types is expected,
+// values of type any are checked on evaluation.
+func accepts(typ Type, types ...Type) bool {
+	if typ == AnyType {
+		return true
+	}
+	for _, t := range types {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
+
+type literalNode struct {
+	at    int
+	value interface{}
+}
+
+func (p *literalNode) pos() int {
+	return p.at
+}
+
+func (p *literalNode) check(env *Env) (Type, error) {
+	switch p.value.(type) {
+	case bool:
+		return BoolType, nil
+	case float64:
+		return NumberType, nil
+	case string:
+		return StringType, nil
+	}
+	return NullType, nil
+}
+
+func (p *literalNode) eval(arg interface{}) (interface{}, error) {
+	return p.value, nil
+}
+
+type identNode struct {
+	at   int
+	name string
+	root Root
+}
+
+func (p *identNode) pos() int {
+	return p.at
+}
+
+func (p *identNode) check(env *Env) (Type, error) {
+	root, ok := env.Roots[p.name]
+	if !ok {
+		return "", errorf(p.at, "unknown identifier %q in %s expressions, expected one of %s",
+			p.name, env.Name, env.names())
+	}
+
+	p.root = root
+	return root.Type, nil
+}
+
+func (p *identNode) eval(arg interface{}) (interface{}, error) {
+	val, ok := p.root.Resolve(arg)
+	if !ok {
+		return nil, errorf(p.at, "%s is undefined for %T", p.name, arg)
+	}
+	return val, nil
+}
+
+var changeFields = map[string]Type{
+	"created": BoolType,
+	"updated": BoolType,
+	"deleted": BoolType,
+	"before":  AnyType,
+	"after":   AnyType,
+}
+
+// memberType returns the type of field name of a value of type typ.
+func memberType(at int, typ Type, name string) (Type, error) {
+	switch typ {
+	case AnyType, MapType:
+		return AnyType, nil
+	case ChangesType:
+		return ChangeType, nil
+	case ChangeType:
+		if t, ok := changeFields[name]; ok {
+			return t, nil
+		}
+		return "", errorf(at, "change has no field %q, expected created, updated, deleted, before or after", name)
+	}
+	return "", errorf(at, "%s has no fields", typ)
+}
+
+// member returns field name of value, fields of null are null.
+func member(at int, value interface{}, name string) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case shared.Properties:
+		return v[name], nil
+	case map[string]interface{}:
+		return v[name], nil
+	case shared.ChangeInfos:
+		return v[name], nil
+	case shared.ChangeInfo:
+		switch name {
+		case "created":
+			return v.Before == nil && v.After != nil, nil
+		case "updated":
+			return !predicate.Equal(v.Before, v.After), nil
+		case "deleted":
+			return v.Before != nil && v.After == nil, nil
+		case "before":
+			return v.Before, nil
+		case "after":
+			return v.After, nil
+		}
+	}
+	return nil, errorf(at, "%T has no field %q", value, name)
+}
+
+type memberNode struct {
+	at   int
+	x    node
+	name string
+}
+
+func (p *memberNode) pos() int {
+	return p.x.pos()
+}
+
+func (p *memberNode) check(env *Env) (Type, error) {
+	typ, err := p.x.check(env)
+	if err != nil {
+		return "", err
+	}
+	return memberType(p.at, typ, p.name)
+}
+
+func (p *memberNode) eval(arg interface{}) (interface{}, error) {
+	x, err := p.x.eval(arg)
+	if err != nil {
+		return nil, err
+	}
+	return member(p.at, x, p.name)
+}
+
+type indexNode struct {
+	at  int
+	x   node
+	key node
+}
+
+func (p *indexNode) pos() int {
+	return p.x.pos()
+}
+
+func (p *indexNode) check(env *Env) (Type, error) {
+	typ, err := p.x.check(env)
+	if err != nil {
+		return "", err
+	}
+
+	keyType, err := p.key.check(env)
+	if err != nil {
+		return "", err
+	}
+	if !accepts(keyType, StringType) {
+		return "", errorf(p.key.pos(), "index is of type %s, expected string", keyType)
+	}
+
+	if lit, ok := p.key.(*literalNode); ok {
+		return memberType(p.at, typ, lit.value.(string))
+	}
+	if typ == ChangeType {
+		return AnyType, nil
+	}
+	return memberType(p.at, typ, "")
+}
+
+func (p *indexNode) eval(arg interface{}) (interface{}, error) {
+	x, err := p.x.eval(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := p.key.eval(arg)
+	if err != nil {
+		return nil, err
+	}
+	name, ok := key.(string)
+	if !ok {
+		return nil, errorf(p.key.pos(), "index is %T, expected string", key)
+	}
+	return member(p.at, x, name)
+}
+
+type listNode struct {
+	at    int
+	items []node
+}
+
+func (p *listNode) pos() int {
+	return p.at
+}
+
+func (p *listNode) check(env *Env) (Type, error) {
+	for _, item := range p.items {
+		if _, err := item.check(env); err != nil {
+			return "", err
+		}
+	}
+	return ListType, nil
+}
+
+func (p *listNode) eval(arg interface{}) (interface{}, error) {
+	res := make([]interface{}, 0, len(p.items))
+	for _, item := range p.items {
+		val, err := item.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, val)
+	}
+	return res, nil
+}
+
+type unaryNode struct {
+	at int
+	op string
+	x  node
+}
+
+func (p *unaryNode) pos() int {
+	return p.at
+}
+
+func (p *unaryNode) check(env *Env) (Type, error) {
+	typ, err := p.x.check(env)
+	if err != nil {
+		return "", err
+	}
+
+	want := BoolType
+	if p.op == "-" {
+		want = NumberType
+	}
+	if !accepts(typ, want) {
+		return "", errorf(p.at, "operator %s expects %s, found %s", p.op, want, typ)
+	}
+	return want, nil
+}
+
+func (p *unaryNode) eval(arg interface{}) (interface{}, error) {
+	x, err := p.x.eval(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.op == "-" {
+		f, ok := shared.AsFloat64(x)
+		if !ok {
+			return nil, errorf(p.at, "operator - expects a number, found %T", x)
+		}
+		return -f, nil
+	}
+
+	b, ok := x.(bool)
+	if !ok {
+		return nil, errorf(p.at, "operator ! expects a bool, found %T", x)
+	}
+	return !b, nil
+}
+
+type binaryNode struct {
+	at    int
+	op    string
+	left  node
+	right node
+}
+
+func (p *binaryNode) pos() int {
+	return p.left.pos()
+}
+
+func (p *binaryNode) check(env *Env) (Type, error) {
+	left, err := p.left.check(env)
+	if err != nil {
+		return "", err
+	}
+	right, err := p.right.check(env)
+	if err != nil {
+		return "", err
+	}
+
+	operands := func(types ...Type) error {
+		if !accepts(left, types...) || !accepts(right, types...) {
+			return errorf(p.at, "operator %s expects %v, found %s and %s", p.op, types, left, right)
+		}
+		return nil
+	}
+
+	switch p.op {
+	case "&&", "||":
+		return BoolType, operands(BoolType)
+	case "==", "!=":
+		if left != right && left != AnyType && right != AnyType && left != NullType && right != NullType {
+			return "", errorf(p.at, "comparing %s with %s is always %t", left, right, p.op == "!=")
+		}
+		return BoolType, nil
+	case "<", "<=", ">", ">=":
+		if err := operands(NumberType, StringType); err != nil {
+			return "", err
+		}
+		if left != right && left != AnyType && right != AnyType {
+			return "", errorf(p.at, "cannot order %s and %s", left, right)
+		}
+		return BoolType, nil
+	case "in":
+		if !accepts(right, ListType) {
+			return "", errorf(p.at, "operator in expects a list, found %s", right)
+		}
+		return BoolType, nil
+	}
+	return NumberType, operands(NumberType)
+}
+
+func (p *binaryNode) eval(arg interface{}) (interface{}, error) {
+	left, err := p.left.eval(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || short-circuit
+	if p.op == "&&" || p.op == "||" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, errorf(p.left.pos(), "operator %s expects a bool, found %T", p.op, left)
+		}
+		if l == (p.op == "||") {
+			return l, nil
+		}
+		right, err := p.right.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := right.(bool)
+		if !ok {
+			return nil, errorf(p.right.pos(), "operator %s expects a bool, found %T", p.op, right)
+		}
+		return r, nil
+	}
+
+	right, err := p.right.eval(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.op {
+	case "==":
+		return predicate.Equal(left, right), nil
+	case "!=":
+		return !predicate.Equal(left, right), nil
+	case "in":
+		items, ok := right.([]interface{})
+		if !ok {
+			return nil, errorf(p.at, "operator in expects a list, found %T", right)
+		}
+		for _, item := range items {
+			if predicate.Equal(left, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "<", "<=", ">", ">=":
+		return order(p.at, p.op, left, right)
+	}
+
+	l, lok := shared.AsFloat64(left)
+	r, rok := shared.AsFloat64(right)
+	if !lok || !rok {
+		return nil, errorf(p.at, "operator %s expects numbers, found %T and %T", p.op, left, right)
+	}
+
+	switch p.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, errorf(p.at, "division by zero")
+		}
+		return l / r, nil
+	}
+	if int64(r) == 0 {
+		return nil, errorf(p.at, "division by zero")
+	}
+	return float64(int64(l) % int64(r)), nil
+}
+
+func order(at int, op string, left, right interface{}) (interface{}, error) {
+	var res int
+	if l, ok := shared.AsFloat64(left); ok {
+		r, ok := shared.AsFloat64(right)
+		if !ok {
+			return nil, errorf(at, "cannot order %T and %T", left, right)
+		}
+		switch {
+		case l < r:
+			res = -1
+		case l > r:
+			res = 1
+		}
+	} else {
+		l, lok := left.(string)
+		r, rok := right.(string)
+		if !lok || !rok {
+			return nil, errorf(at, "cannot order %T and %T", left, right)
+		}
+		switch {
+		case l < r:
+			res = -1
+		case l > r:
+			res = 1
+		}
+	}
+
+	switch op {
+	case "<":
+		return res < 0, nil
+	case "<=":
+		return res <= 0, nil
+	case ">":
+		return res > 0, nil
+	}
+	return res >= 0, nil
+}
+
+type callNode struct {
+	at   int
+	fn   string
+	args []node
+	re   *regexp.Regexp
+}
+
+func (p *callNode) pos() int {
+	return p.at
+}
+
+func (p *callNode) check(env *Env) (Type, error) {
+	if len(p.args) != functions[p.fn] {
+		return "", errorf(p.at, "%s expects %d arguments, found %d", p.fn, functions[p.fn], len(p.args))
+	}
+
+	types := []Type{}
+	for _, arg := range p.args {
+		typ, err := arg.check(env)
+		if err != nil {
+			return "", err
+		}
+		types = append(types, typ)
+	}
+
+	switch p.fn {
+	case "matches":
+		if !accepts(types[0], StringType) {
+			return "", errorf(p.args[0].pos(), "matches expects a string, found %s", types[0])
+		}
+		lit, ok := p.args[1].(*literalNode)
+		if !ok || types[1] != StringType {
+			return "", errorf(p.args[1].pos(), "matches expects a string literal pattern")
+		}
+		re, err := regexp.Compile(lit.value.(string))
+		if err != nil {
+			return "", errorf(p.args[1].pos(), "invalid pattern: %s", err)
+		}
+		p.re = re
+		return BoolType, nil
+	}
+
+	if !accepts(types[0], StringType, ListType, MapType) {
+		return "", errorf(p.args[0].pos(), "len expects a string, list or map, found %s", types[0])
+	}
+	return NumberType, nil
+}
+
+func (p *callNode) eval(arg interface{}) (interface{}, error) {
+	x, err := p.args[0].eval(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.fn == "matches" {
+		s, ok := x.(string)
+		return ok && p.re.MatchString(s), nil
+	}
+
+	switch v := x.(type) {
+	case string:
+		return float64(utf8.RuneCountInString(v)), nil
+	case []interface{}:
+		return float64(len(v)), nil
+	case shared.Properties:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	case nil:
+		return float64(0), nil
+	}
+	return nil, errorf(p.at, "len expects a string, list or map, found %T", x)
+}
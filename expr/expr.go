@@ -0,0 +1,239 @@
+// Package expr compiles condition expressions for event and hub chains:
+//
+//	props.age >= 18 && changes.email.updated
+//	sender in ["Person", "Photo"] && !matches(props.name, "^tmp_")
+//
+// Expressions are type checked against an Env when they are compiled. Values
+// of props and of changes before and after are dynamic and checked when the
+// expression is evaluated, an expression that fails at that point evaluates
+// to false. Supported are the operators || && ! == != < <= > >= in + - * / %,
+// list literals, null and the functions matches(string, pattern) and len(x),
+// which counts the characters of a string. Strings are quoted with " or ', a
+// backslash escapes only quotes and itself, so patterns like "^\d{5}$" are
+// written as in YAML and Go raw strings. Source is UTF-8, error columns count
+// characters.
+//
+// The language is deliberately small instead of embedding a general purpose
+// expression library: it only knows the contexts of nksh chains, so a rule is
+// type checked against them when it is loaded, and it keeps the evaluation
+// semantics of the chain selectors, where a missing property or a value of
+// another type does not match rather than failing the chain.
+package expr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/denkhaus/nksh/shared"
+)
+
+type Type string
+
+var (
+	AnyType     = Type("any")
+	NullType    = Type("null")
+	BoolType    = Type("bool")
+	NumberType  = Type("number")
+	StringType  = Type("string")
+	ListType    = Type("list")
+	MapType     = Type("map")
+	ChangesType = Type("changes")
+	ChangeType  = Type("change")
+)
+
+// Error is a problem at the 1-based column Pos of an expression.
+type Error struct {
+	Pos     int
+	Message string
+}
+
+func (p Error) Error() string {
+	return fmt.Sprintf("col %d: %s", p.Pos, p.Message)
+}
+
+func errorf(pos int, format string, args ...interface{}) error {
+	return Error{Pos: pos + 1, Message: fmt.Sprintf(format, args...)}
+}
+
+// Root is an identifier of an Env, resolved from the context an expression is evaluated on.
+type Root struct {
+	Type    Type
+	Resolve func(arg interface{}) (interface{}, bool)
+}
+
+// Env defines the identifiers available to expressions.
+type Env struct {
+	Name  string
+	Roots map[string]Root
+}
+
+func (p *Env) names() string {
+	names := make([]string, 0, len(p.Roots))
+	for name := range p.Roots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func eventContext(arg interface{}) (*shared.EventContext, bool) {
+	switch ctx := arg.(type) {
+	case shared.EventContext:
+		return &ctx, true
+	case *shared.EventContext:
+		return ctx, ctx != nil
+	}
+	return nil, false
+}
+
+func hubContext(arg interface{}) (*shared.HubContext, bool) {
+	switch ctx := arg.(type) {
+	case shared.HubContext:
+		return &ctx, true
+	case *shared.HubContext:
+		return ctx, ctx != nil
+	}
+	return nil, false
+}
+
+// EventEnv evaluates expressions on EventContexts.
+var EventEnv = &Env{
+	Name: "event",
+	Roots: map[string]Root{
+		"props": {MapType, func(arg interface{}) (interface{}, bool) {
+			ctx, ok := eventContext(arg)
+			if !ok {
+				return nil, false
+			}
+			return ctx.Properties, true
+		}},
+		"changes": {ChangesType, func(arg interface{}) (interface{}, bool) {
+			ctx, ok := eventContext(arg)
+			if !ok {
+				return nil, false
+			}
+			return ctx.ChangeInfos, true
+		}},
+		"labels": {ListType, func(arg interface{}) (interface{}, bool) {
+			ctx, ok := eventContext(arg)
+			if !ok {
+				return nil, false
+			}
+			labels := make([]interface{}, 0, len(ctx.Labels))
+			for _, label := range ctx.Labels {
+				labels = append(labels, label)
+			}
+			return labels, true
+		}},
+		"operation": {StringType, func(arg interface{}) (interface{}, bool) {
+			ctx, ok := eventContext(arg)
+			if !ok {
+				return nil, false
+			}
+			return string(ctx.Operation), true
+		}},
+	},
+}
+
+// HubEnv evaluates expressions on HubContexts.
+var HubEnv = &Env{
+	Name: "hub",
+	Roots: map[string]Root{
+		"props": {MapType, func(arg interface{}) (interface{}, bool) {
+			ctx, ok := hubContext(arg)
+			if !ok {
+				return nil, false
+			}
+			return ctx.Properties, true
+		}},
+		"sender": {StringType, func(arg interface{}) (interface{}, bool) {
+			ctx, ok := hubContext(arg)
+			if !ok {
+				return nil, false
+			}
+			return ctx.Sender, true
+		}},
+		"receiver": {StringType, func(arg interface{}) (interface{}, bool) {
+			ctx, ok := hubContext(arg)
+			if !ok {
+				return nil, false
+			}
+			return ctx.Receiver, true
+		}},
+		"operation": {StringType, func(arg interface{}) (interface{}, bool) {
+			ctx, ok := hubContext(arg)
+			if !ok {
+				return nil, false
+			}
+			return string(ctx.Operation), true
+		}},
+	},
+}
+
+// Program is a compiled expression.
+type Program struct {
+	src  string
+	root node
+}
+
+// Compile parses src and type checks it against env.
+func Compile(src string, env *Env) (*Program, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{tokens: tokens}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	typ, err := root.check(env)
+	if err != nil {
+		return nil, err
+	}
+	if typ != BoolType && typ != AnyType {
+		return nil, errorf(0, "expression is of type %s, expected bool", typ)
+	}
+
+	prog := Program{
+		src:  src,
+		root: root,
+	}
+	return &prog, nil
+}
+
+// MustCompile is like Compile but panics if src is invalid.
+func MustCompile(src string, env *Env) *Program {
+	prog, err := Compile(src, env)
+	if err != nil {
+		panic(fmt.Sprintf("expr: compile %q: %s", src, err))
+	}
+	return prog
+}
+
+// Evaluate evaluates the program on an EventContext or HubContext.
+func (p *Program) Evaluate(arg interface{}) (bool, error) {
+	val, err := p.root.eval(arg)
+	if err != nil {
+		return false, err
+	}
+
+	res, ok := val.(bool)
+	if !ok {
+		return false, errorf(0, "expression evaluated to %T, expected bool", val)
+	}
+	return res, nil
+}
+
+// Eval is a shared.EvalFunc, it is false if the evaluation fails.
+func (p *Program) Eval(arg interface{}) bool {
+	res, _ := p.Evaluate(arg)
+	return res
+}
+
+func (p *Program) String() string {
+	return p.src
+}
@@ -0,0 +1,136 @@
+package expr
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/denkhaus/nksh/shared"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluate(t *testing.T) {
+	evt := shared.EventContext{
+		Operation: shared.UpdatedOperation,
+		Labels:    []string{"Person"},
+		ChangeInfos: shared.ChangeInfos{
+			"email": shared.ChangeInfo{Before: "a@b.org", After: "c@d.org"},
+			"geo":   shared.ChangeInfo{Before: []interface{}{1.0}, After: []interface{}{1.0}},
+		},
+		Properties: shared.Properties{
+			"age":        float64(21),
+			"rank":       int64(3),
+			"name":       "tmp_anne",
+			"first name": "Anne",
+			"city":       "Zürich",
+			"address":    map[string]interface{}{"city": "Berlin"},
+			"zip":        "12345",
+			"quote":      `say "hi"`,
+			"path":       `C:\dir`,
+			"small":      int8(3),
+			"count":      uint32(4),
+			"size":       uint(5),
+		},
+	}
+
+	for src, want := range map[string]bool{
+		`props.age >= 18 && changes.email.updated`:                 true,
+		`props.age >= 18 && !changes.geo.updated`:                  true,
+		`changes.email.before == "a@b.org"`:                        true,
+		`changes.missing.created || changes.missing.deleted`:       false,
+		`"Person" in labels && operation == "updated"`:             true,
+		`props.rank * 2 + 1 == 7 && props.rank % 2 == 1`:           true,
+		`props.rank in [1, 2, 3]`:                                  true,
+		`matches(props.name, "^tmp_")`:                             true,
+		`props["first name"] == 'Anne'`:                            true,
+		`props.address.city == "Berlin"`:                           true,
+		`props.missing.city == null`:                               true,
+		`len(labels) == 1 && len(props.name) > 3`:                  true,
+		`-props.age < 0 && (props.age > 30 || props.age < 25)`:     true,
+		`matches(props.zip, "^\d{5}$")`:                            true,
+		`props.quote == "say \"hi\"" && props.quote == 'say "hi"'`: true,
+		`props.path == 'C:\\dir' && props.path == "C:\dir"`:        true,
+		`props.small > 1 && props.count >= 4 && props.size < 6`:    true,
+		`props.small + props.count == 7`:                           true,
+		`props.city == "Zürich" && len(props.city) == 6`:           true,
+		`props.name > 10`:                                          false,
+		`props.age / 0 > 1`:                                        false,
+	} {
+		prog, err := Compile(src, EventEnv)
+		if !assert.NoError(t, err, src) {
+			continue
+		}
+		assert.Equal(t, want, prog.Eval(evt), src)
+		assert.Equal(t, want, prog.Eval(&evt), src)
+	}
+
+	hub := shared.HubContext{
+		Sender:     "Photo",
+		Properties: shared.Properties{"visible": false},
+	}
+	prog := MustCompile(`sender == "Photo" && props.visible == false`, HubEnv)
+	assert.True(t, prog.Eval(hub))
+	assert.False(t, prog.Eval(evt), "foreign context")
+}
+
+func TestCompileErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		`props.age >= `:                      `col 14: unexpected end of expression`,
+		`props.age >= 18 18`:                 `col 17: unexpected "18"`,
+		`sender == "Photo"`:                  `col 1: unknown identifier "sender" in event expressions, expected one of changes, labels, operation, props`,
+		`changes.email.changed`:              `col 15: change has no field "changed", expected created, updated, deleted, before or after`,
+		`operation == 1`:                     `col 11: comparing string with number is always false`,
+		`operation < 1`:                      `col 11: cannot order string and number`,
+		`props.age + 1`:                      `col 1: expression is of type number, expected bool`,
+		`changes.email.updated && "yes"`:     `col 23: operator && expects [bool], found bool and string`,
+		`matches(props.name, props.pattern)`: `col 21: matches expects a string literal pattern`,
+		`matches(props.name, "[")`:           "col 21: invalid pattern: error parsing regexp: missing closing ]: `[`",
+		`props.age < 1 < 2`:                  `col 15: comparisons cannot be chained`,
+		`props.name == "anne`:                `col 15: unterminated string`,
+		`operation.name`:                     `col 11: string has no fields`,
+		`props.city == "Zürich" 18`:          `col 24: unexpected "18"`,
+		`props.city == "Zürich" ° 1`:         `col 24: unexpected character '°'`,
+		"props.city == \"Z\xfcrich\"":        `col 17: invalid UTF-8 encoding`,
+	} {
+		_, err := Compile(src, EventEnv)
+		if assert.Error(t, err, src) {
+			assert.Equal(t, want, err.Error(), src)
+		}
+	}
+
+	assert.Panics(t, func() {
+		MustCompile(`labels`, HubEnv)
+	})
+}
+
+func FuzzCompile(f *testing.F) {
+	for _, src := range []string{
+		`props.age >= 18 && changes.email.updated`,
+		`"Person" in labels && operation == "updated"`,
+		`matches(props.zip, "^\d{5}$") || props["first name"] == 'Anne'`,
+		`props.city == "Zürich" && len(props.city) == 6`,
+		`-props.age < 0 && (props.age > 30 || props.rank % 2 == 1)`,
+		`props.name == "anne`,
+	} {
+		f.Add(src)
+	}
+
+	evt := &shared.EventContext{
+		Operation:   shared.UpdatedOperation,
+		Labels:      []string{"Person"},
+		ChangeInfos: shared.ChangeInfos{"email": shared.ChangeInfo{Before: "a@b.org", After: "c@d.org"}},
+		Properties:  shared.Properties{"age": float64(21), "city": "Zürich"},
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		prog, err := Compile(src, EventEnv)
+		if err != nil {
+			e, ok := err.(Error)
+			if assert.True(t, ok, "error type") {
+				assert.True(t, e.Pos >= 1 && e.Pos <= utf8.RuneCountInString(src)+1, "error column %d", e.Pos)
+			}
+			return
+		}
+		prog.Eval(evt)
+		prog.Eval(shared.HubContext{})
+	})
+}
@@ -0,0 +1,114 @@
+package expr
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind string
+
+var (
+	tokenEOF    = tokenKind("end of expression")
+	tokenNumber = tokenKind("number")
+	tokenString = tokenKind("string")
+	tokenIdent  = tokenKind("identifier")
+	tokenPunct  = tokenKind("operator")
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+// punctuation is ordered longest first, so "<=" is not lexed as "<" "=".
+var punctuation = []string{
+	"&&", "||", "==", "!=", "<=", ">=",
+	"(", ")", "[", "]", ",", ".", "!", "<", ">", "+", "-", "*", "/", "%",
+}
+
+// lex splits src into tokens, positioned by the offset in runes their source starts at.
+func lex(src string) ([]token, error) {
+	tokens := []token{}
+	i, col := 0, 0
+	peek := func() (rune, int) {
+		return utf8.DecodeRuneInString(src[i:])
+	}
+	advance := func(size int) {
+		i += size
+		col++
+	}
+
+	for i < len(src) {
+		c, size := peek()
+		start, startCol := i, col
+		switch {
+		case c == utf8.RuneError && size == 1:
+			return nil, errorf(col, "invalid UTF-8 encoding")
+		case unicode.IsSpace(c):
+			advance(size)
+		case unicode.IsDigit(c):
+			for i < len(src) {
+				if c, size = peek(); !unicode.IsDigit(c) && c != '.' {
+					break
+				}
+				advance(size)
+			}
+			f, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, errorf(startCol, "invalid number %q", src[start:i])
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: src[start:i], value: f, pos: startCol})
+		case c == '"' || c == '\'':
+			quote := c
+			var b strings.Builder
+			for advance(size); i < len(src); advance(size) {
+				if c, size = peek(); c == quote {
+					break
+				}
+				if c == utf8.RuneError && size == 1 {
+					return nil, errorf(col, "invalid UTF-8 encoding")
+				}
+				// only quotes and backslashes are escaped, so regexp escapes like \d
+				// can be written as in YAML and Go raw strings
+				if c == '\\' && i+1 < len(src) && strings.IndexByte(`"'\\`, src[i+1]) >= 0 {
+					advance(size)
+					c, size = peek()
+				}
+				b.WriteRune(c)
+			}
+			if i >= len(src) {
+				return nil, errorf(startCol, "unterminated string")
+			}
+			advance(size)
+			tokens = append(tokens, token{kind: tokenString, text: src[start:i], value: b.String(), pos: startCol})
+		case c == '_' || unicode.IsLetter(c):
+			for i < len(src) {
+				if c, size = peek(); c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+					break
+				}
+				advance(size)
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: src[start:i], pos: startCol})
+		default:
+			found := false
+			for _, punct := range punctuation {
+				if strings.HasPrefix(src[i:], punct) {
+					tokens = append(tokens, token{kind: tokenPunct, text: punct, pos: col})
+					i += len(punct)
+					col += len(punct)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, errorf(col, "unexpected character %q", c)
+			}
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: col}), nil
+}
@@ -0,0 +1,228 @@
+package expr
+
+var (
+	comparisons = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "in": true}
+	functions   = map[string]int{"matches": 2, "len": 1}
+)
+
+// parser is a recursive descent parser, from lowest to highest precedence:
+// ||, &&, comparisons and in, + -, * / %, unary ! -, member access and index.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) is(texts ...string) bool {
+	t := p.peek()
+	if t.kind != tokenPunct && t.kind != tokenIdent {
+		return false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if t := p.next(); t.text != text || t.kind != tokenPunct {
+		return errorf(t.pos, "expected %q, found %s", text, describe(t))
+	}
+	return nil
+}
+
+func describe(t token) string {
+	if t.kind == tokenEOF {
+		return string(t.kind)
+	}
+	return "\"" + t.text + "\""
+}
+
+func (p *parser) parse() (node, error) {
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, errorf(t.pos, "unexpected %s", describe(t))
+	}
+	return n, nil
+}
+
+func (p *parser) binary(operand func() (node, error), ops ...string) (node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.is(ops...) {
+		op := p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{at: op.pos, op: op.text, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) or() (node, error) {
+	return p.binary(p.and, "||")
+}
+
+func (p *parser) and() (node, error) {
+	return p.binary(p.comparison, "&&")
+}
+
+// comparison does not chain, a < b < c is rejected.
+func (p *parser) comparison() (node, error) {
+	left, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); (t.kind == tokenPunct || t.kind == tokenIdent) && comparisons[t.text] {
+		op := p.next()
+		right, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{at: op.pos, op: op.text, left: left, right: right}
+	}
+	if t := p.peek(); t.kind == tokenPunct && comparisons[t.text] {
+		return nil, errorf(t.pos, "comparisons cannot be chained")
+	}
+	return left, nil
+}
+
+func (p *parser) additive() (node, error) {
+	return p.binary(p.multiplicative, "+", "-")
+}
+
+func (p *parser) multiplicative() (node, error) {
+	return p.binary(p.unary, "*", "/", "%")
+}
+
+func (p *parser) unary() (node, error) {
+	if p.peek().kind == tokenPunct && p.is("!", "-") {
+		op := p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{at: op.pos, op: op.text, x: x}, nil
+	}
+	return p.postfix()
+}
+
+func (p *parser) postfix() (node, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenPunct {
+		switch {
+		case p.is("."):
+			p.next()
+			name := p.next()
+			if name.kind != tokenIdent {
+				return nil, errorf(name.pos, "expected a field name, found %s", describe(name))
+			}
+			x = &memberNode{at: name.pos, x: x, name: name.text}
+		case p.is("["):
+			at := p.next().pos
+			key, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &indexNode{at: at, x: x, key: key}
+		default:
+			return x, nil
+		}
+	}
+	return x, nil
+}
+
+func (p *parser) list(end string) ([]node, error) {
+	items := []node{}
+	if p.peek().kind == tokenPunct && p.is(end) {
+		p.next()
+		return items, nil
+	}
+
+	for {
+		item, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		if p.peek().kind == tokenPunct && p.is(",") {
+			p.next()
+			continue
+		}
+		if err := p.expect(end); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber, tokenString:
+		return &literalNode{at: t.pos, value: t.value}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{at: t.pos, value: true}, nil
+		case "false":
+			return &literalNode{at: t.pos, value: false}, nil
+		case "null":
+			return &literalNode{at: t.pos, value: nil}, nil
+		}
+		if _, ok := functions[t.text]; ok && p.is("(") {
+			p.next()
+			args, err := p.list(")")
+			if err != nil {
+				return nil, err
+			}
+			return &callNode{at: t.pos, fn: t.text, args: args}, nil
+		}
+		return &identNode{at: t.pos, name: t.text}, nil
+	case tokenPunct:
+		switch t.text {
+		case "(":
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			items, err := p.list("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{at: t.pos, items: items}, nil
+		}
+	}
+	return nil, errorf(t.pos, "unexpected %s", describe(t))
+}
@@ -1,7 +1,7 @@
 module github.com/denkhaus/nksh
 
 require (
-	github.com/Shopify/sarama v1.21.0 // indirect
+	github.com/Shopify/sarama v1.21.0
 	github.com/bsm/sarama-cluster v2.1.15+incompatible // indirect
 	github.com/facebookgo/ensure v0.0.0-20160127193407-b4ab57deab51 // indirect
 	github.com/facebookgo/stack v0.0.0-20160209184415-751773369052 // indirect
@@ -20,6 +20,7 @@ require (
 	github.com/neo4j-drivers/gobolt v1.7.2 // indirect
 	github.com/neo4j/neo4j-go-driver v1.7.2
 	github.com/pkg/errors v0.8.1 // indirect
+	github.com/prometheus/client_golang v0.9.2
 	github.com/samuel/go-zookeeper v0.0.0-20180130194729-c4fab1ac1bec // indirect
 	github.com/sirupsen/logrus v1.3.0
 	github.com/stretchr/testify v1.3.0
@@ -33,4 +34,5 @@ require (
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 	gopkg.in/mgo.v2 v2.0.0-20180705113604-9856a29383ce // indirect
 	gopkg.in/yaml.v2 v2.2.2 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
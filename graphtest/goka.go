@@ -0,0 +1,134 @@
+package graphtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/denkhaus/nksh/shared"
+	"github.com/lovoo/goka"
+)
+
+// Emitted is a message emitted through a Context.
+type Emitted struct {
+	Stream goka.Stream
+	Key    string
+	Value  interface{}
+}
+
+// embedded through an alias, the promoted Context method does not clash with the field name
+type gokaContext = goka.Context
+
+// Context is a goka.Context for unit tests of goka callbacks, it records all emitted and
+// looped back messages. Methods other than Topic, Key, Value, SetValue, Delete, Emit and
+// Loopback panic.
+type Context struct {
+	gokaContext
+	topic goka.Stream
+	key   string
+	value interface{}
+	Emits []Emitted
+	Loops []Emitted
+}
+
+func NewContext(topic goka.Stream, key string) *Context {
+	ctx := Context{
+		topic: topic,
+		key:   key,
+	}
+	return &ctx
+}
+
+func (p *Context) Topic() goka.Stream {
+	return p.topic
+}
+
+func (p *Context) Key() string {
+	return p.key
+}
+
+func (p *Context) Value() interface{} {
+	return p.value
+}
+
+func (p *Context) SetValue(value interface{}) {
+	p.value = value
+}
+
+func (p *Context) Delete() {
+	p.value = nil
+}
+
+func (p *Context) Emit(stream goka.Stream, key string, value interface{}) {
+	p.Emits = append(p.Emits, Emitted{stream, key, value})
+}
+
+// Loopback records value with an empty Stream.
+func (p *Context) Loopback(key string, value interface{}) {
+	p.Loops = append(p.Loops, Emitted{Key: key, Value: value})
+}
+
+// Streams returns the streams of all emitted messages in order.
+func (p *Context) Streams() []goka.Stream {
+	streams := []goka.Stream{}
+	for _, e := range p.Emits {
+		streams = append(streams, e.Stream)
+	}
+	return streams
+}
+
+// Descriptor is an EntityDescriptor without context queries.
+type Descriptor struct {
+	*shared.BaseDescriptor
+}
+
+func NewDescriptor(label string) *Descriptor {
+	return &Descriptor{shared.NewBaseDescriptor(label)}
+}
+
+func (p *Descriptor) ContextDef() shared.ContextDefinition {
+	return shared.ContextDefinition{}
+}
+
+// Metrics counts the measurements reported by consumers and executors by method name,
+// e.g. Count("DecodeFailed").
+type Metrics struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{counts: make(map[string]int)}
+}
+
+func (p *Metrics) inc(method string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counts[method]++
+}
+
+// Count returns the number of calls of method.
+func (p *Metrics) Count(method string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.counts[method]
+}
+
+func (p *Metrics) MessageConsumed(label string, stream goka.Stream) {
+	p.inc("MessageConsumed")
+}
+
+func (p *Metrics) DecodeFailed(label string, stream goka.Stream) {
+	p.inc("DecodeFailed")
+}
+
+func (p *Metrics) MessageUnroutable(receiver string, stream goka.Stream) {
+	p.inc("MessageUnroutable")
+}
+
+func (p *Metrics) ChainHandled(label, chain string, state shared.ChainHandledState, duration time.Duration) {
+	p.inc("ChainHandled")
+}
+
+func (p *Metrics) QueryExecuted(label, chain string, duration time.Duration, err error) {
+	p.inc("QueryExecuted")
+}
@@ -0,0 +1,358 @@
+// Package graphtest provides an in-memory shared.GraphClient for unit tests of
+// handlers. It records all executed cypher and returns scripted records.
+// Context and Descriptor are the goka.Context and EntityDescriptor to go with it.
+package graphtest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+)
+
+// Query is a cypher statement executed by the Client.
+type Query struct {
+	Cypher string
+	Params map[string]interface{}
+	// Tx is true if the query ran in an explicit transaction.
+	Tx bool
+}
+
+// Script answers the queries containing its pattern.
+type Script struct {
+	pattern string
+	records []neo4j.Record
+	err     error
+}
+
+// Return sets the records returned for matching queries.
+func (p *Script) Return(records ...neo4j.Record) *Script {
+	p.records = records
+	return p
+}
+
+// Fail lets matching queries fail with err.
+func (p *Script) Fail(err error) *Script {
+	p.err = err
+	return p
+}
+
+// Client is a fake shared.GraphClient. Queries without a matching Script
+// succeed with an empty result.
+type Client struct {
+	mu        sync.Mutex
+	scripts   []*Script
+	queries   []Query
+	commits   int
+	rollbacks int
+	sessions  int
+	closed    int
+}
+
+// NewClient returns an empty Client.
+func NewClient() *Client {
+	return &Client{}
+}
+
+// normalize collapses all whitespace, so patterns need not match the indentation of queries.
+func normalize(cypher string) string {
+	return strings.Join(strings.Fields(cypher), " ")
+}
+
+// OnQuery scripts the answer to all queries containing pattern.
+// Scripts are matched in the order they were added.
+func (p *Client) OnQuery(pattern string) *Script {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := &Script{pattern: normalize(pattern)}
+	p.scripts = append(p.scripts, s)
+	return s
+}
+
+// Session implements shared.GraphClient.
+func (p *Client) Session(mode neo4j.AccessMode) (shared.GraphSession, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sessions++
+	return &session{client: p}, nil
+}
+
+func (p *Client) run(cypher string, params map[string]interface{}, tx bool) (neo4j.Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.queries = append(p.queries, Query{
+		Cypher: cypher,
+		Params: params,
+		Tx:     tx,
+	})
+
+	normalized := normalize(cypher)
+	for _, s := range p.scripts {
+		if strings.Contains(normalized, s.pattern) {
+			if s.err != nil {
+				return nil, s.err
+			}
+			return newResult(s.records), nil
+		}
+	}
+
+	return newResult(nil), nil
+}
+
+// Queries returns all queries executed so far.
+func (p *Client) Queries() []Query {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Query{}, p.queries...)
+}
+
+// Executed returns the executed queries containing pattern.
+func (p *Client) Executed(pattern string) []Query {
+	pattern = normalize(pattern)
+	res := []Query{}
+	for _, q := range p.Queries() {
+		if strings.Contains(normalize(q.Cypher), pattern) {
+			res = append(res, q)
+		}
+	}
+
+	return res
+}
+
+// Commits returns the number of committed transactions.
+func (p *Client) Commits() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.commits
+}
+
+// Rollbacks returns the number of rolled back transactions.
+func (p *Client) Rollbacks() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rollbacks
+}
+
+// OpenSessions returns the number of sessions not closed yet.
+func (p *Client) OpenSessions() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sessions - p.closed
+}
+
+// Reset forgets all executed queries and transactions, scripts are kept.
+func (p *Client) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.queries = nil
+	p.commits = 0
+	p.rollbacks = 0
+	p.sessions = 0
+	p.closed = 0
+}
+
+// AssertExecuted fails t unless a query containing pattern was executed. If params is
+// not nil, the parameters of the query must contain params as well.
+// It returns the first matching query.
+func (p *Client) AssertExecuted(t testing.TB, pattern string, params map[string]interface{}) Query {
+	t.Helper()
+	for _, q := range p.Executed(pattern) {
+		if containsParams(q.Params, params) {
+			return q
+		}
+	}
+
+	t.Errorf("no query %q with params %v executed, got:\n%s", pattern, params, p.dump())
+	return Query{}
+}
+
+// AssertNotExecuted fails t if a query containing pattern was executed.
+func (p *Client) AssertNotExecuted(t testing.TB, pattern string) {
+	t.Helper()
+	if len(p.Executed(pattern)) > 0 {
+		t.Errorf("unexpected query %q executed, got:\n%s", pattern, p.dump())
+	}
+}
+
+func (p *Client) dump() string {
+	var b strings.Builder
+	for _, q := range p.Queries() {
+		fmt.Fprintf(&b, "\t%s %v\n", normalize(q.Cypher), q.Params)
+	}
+	return b.String()
+}
+
+func containsParams(params, expected map[string]interface{}) bool {
+	for key, value := range expected {
+		v, ok := params[key]
+		if !ok || fmt.Sprintf("%v", v) != fmt.Sprintf("%v", value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type session struct {
+	client *Client
+}
+
+func (p *session) Run(cypher string, params map[string]interface{}) (neo4j.Result, error) {
+	return p.client.run(cypher, params, false)
+}
+
+func (p *session) BeginTransaction() (shared.GraphTransaction, error) {
+	return &transaction{client: p.client}, nil
+}
+
+func (p *session) Close() error {
+	p.client.mu.Lock()
+	defer p.client.mu.Unlock()
+	p.client.closed++
+	return nil
+}
+
+type transaction struct {
+	client *Client
+	done   bool
+}
+
+func (p *transaction) Run(cypher string, params map[string]interface{}) (neo4j.Result, error) {
+	if p.done {
+		return nil, errors.New("transaction already closed")
+	}
+	return p.client.run(cypher, params, true)
+}
+
+func (p *transaction) Commit() error {
+	if p.done {
+		return errors.New("transaction already closed")
+	}
+
+	p.done = true
+	p.client.mu.Lock()
+	defer p.client.mu.Unlock()
+	p.client.commits++
+	return nil
+}
+
+func (p *transaction) Rollback() error {
+	if p.done {
+		return errors.New("transaction already closed")
+	}
+
+	p.done = true
+	p.client.mu.Lock()
+	defer p.client.mu.Unlock()
+	p.client.rollbacks++
+	return nil
+}
+
+func (p *transaction) Close() error {
+	if !p.done {
+		return p.Rollback()
+	}
+	return nil
+}
+
+// Record is a scripted neo4j.Record.
+type Record struct {
+	keys   []string
+	values []interface{}
+}
+
+// NewRecord returns a Record holding values, its keys are sorted by name.
+func NewRecord(values map[string]interface{}) *Record {
+	r := Record{}
+	for key := range values {
+		r.keys = append(r.keys, key)
+	}
+
+	sort.Strings(r.keys)
+	for _, key := range r.keys {
+		r.values = append(r.values, values[key])
+	}
+
+	return &r
+}
+
+func (p *Record) Keys() []string {
+	return p.keys
+}
+
+func (p *Record) Values() []interface{} {
+	return p.values
+}
+
+func (p *Record) Get(key string) (interface{}, bool) {
+	for i, k := range p.keys {
+		if k == key {
+			return p.values[i], true
+		}
+	}
+
+	return nil, false
+}
+
+func (p *Record) GetByIndex(index int) interface{} {
+	if index < 0 || index >= len(p.values) {
+		return nil
+	}
+	return p.values[index]
+}
+
+type result struct {
+	records []neo4j.Record
+	current neo4j.Record
+	index   int
+}
+
+func newResult(records []neo4j.Record) *result {
+	return &result{records: records}
+}
+
+func (p *result) Keys() ([]string, error) {
+	if len(p.records) == 0 {
+		return []string{}, nil
+	}
+	return p.records[0].Keys(), nil
+}
+
+func (p *result) Next() bool {
+	if p.index >= len(p.records) {
+		p.current = nil
+		return false
+	}
+
+	p.current = p.records[p.index]
+	p.index++
+	return true
+}
+
+func (p *result) Err() error {
+	return nil
+}
+
+func (p *result) Record() neo4j.Record {
+	return p.current
+}
+
+func (p *result) Summary() (neo4j.ResultSummary, error) {
+	return nil, nil
+}
+
+func (p *result) Consume() (neo4j.ResultSummary, error) {
+	p.index = len(p.records)
+	p.current = nil
+	return nil, nil
+}
@@ -0,0 +1,241 @@
+// Package health implements shared.Health and serves the state of the
+// processors and the graph database as liveness and readiness endpoints.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	log logrus.FieldLogger = logrus.New().WithField("package", "health")
+)
+
+var (
+	DefaultPingInterval         = 10 * time.Second
+	DefaultUnreachableThreshold = 1 * time.Minute
+)
+
+// processor is the state of a registered processor, reported through the checker.
+type processor struct {
+	checker   *Checker
+	name      string
+	started   bool
+	recovered func() bool
+	stopped   bool
+	err       error
+}
+
+func (p *processor) Started(recovered func() bool) {
+	p.checker.mu.Lock()
+	defer p.checker.mu.Unlock()
+	p.started = true
+	p.recovered = recovered
+}
+
+func (p *processor) Stopped(err error) {
+	p.checker.mu.Lock()
+	defer p.checker.mu.Unlock()
+	p.stopped = true
+	p.err = err
+}
+
+type Option func(p *Checker)
+
+// WithGraphClient sets the client whose connectivity is verified,
+// without it the graph database is not checked at all.
+func WithGraphClient(client shared.GraphClient) Option {
+	return func(p *Checker) {
+		p.graph = client
+	}
+}
+
+// WithPingInterval sets the interval the graph database is pinged in.
+func WithPingInterval(interval time.Duration) Option {
+	return func(p *Checker) {
+		p.pingInterval = interval
+	}
+}
+
+// WithUnreachableThreshold sets how long the graph database may be
+// unreachable before the checker is not live anymore.
+func WithUnreachableThreshold(threshold time.Duration) Option {
+	return func(p *Checker) {
+		p.unreachableThreshold = threshold
+	}
+}
+
+// Checker collects the state of processors and the graph database.
+type Checker struct {
+	graph                shared.GraphClient
+	pingInterval         time.Duration
+	unreachableThreshold time.Duration
+	processors           []*processor
+	graphVerified        bool
+	graphErr             error
+	lastReachable        time.Time
+	started              time.Time
+	mu                   sync.Mutex
+}
+
+func NewChecker(opts ...Option) *Checker {
+	c := Checker{
+		pingInterval:         DefaultPingInterval,
+		unreachableThreshold: DefaultUnreachableThreshold,
+		started:              time.Now(),
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return &c
+}
+
+// RegisterProcessor tracks a processor, the checker is not ready until it started.
+func (p *Checker) RegisterProcessor(name string) shared.ProcessorHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proc := &processor{checker: p, name: name}
+	p.processors = append(p.processors, proc)
+	return proc
+}
+
+// Ping verifies the connectivity of the graph database once.
+func (p *Checker) Ping() error {
+	if p.graph == nil {
+		return nil
+	}
+
+	err := shared.PingGraph(p.graph)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.graphErr = err
+	if err == nil {
+		p.graphVerified = true
+		p.lastReachable = time.Now()
+	}
+
+	return err
+}
+
+// Run pings the graph database until ctx is done.
+func (p *Checker) Run(ctx context.Context) {
+	if p.graph == nil {
+		return
+	}
+
+	ticker := time.NewTicker(p.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Ping(); err != nil {
+			log.Warning(errors.Annotate(err, "Ping"))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sorted returns the processors ordered by name.
+func (p *Checker) sorted() []*processor {
+	procs := append([]*processor{}, p.processors...)
+	sort.SliceStable(procs, func(i, j int) bool {
+		return procs[i].name < procs[j].name
+	})
+	return procs
+}
+
+// Ready returns the reasons the dispatchers are not ready yet, i.e. not all registered
+// processors started and recovered or the graph database has not been reached yet.
+func (p *Checker) Ready() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	reasons := []string{}
+	for _, proc := range p.sorted() {
+		switch {
+		case proc.stopped:
+			reasons = append(reasons, fmt.Sprintf("processor %s stopped", proc.name))
+		case !proc.started:
+			reasons = append(reasons, fmt.Sprintf("processor %s not started", proc.name))
+		case !proc.recovered():
+			reasons = append(reasons, fmt.Sprintf("processor %s recovering", proc.name))
+		}
+	}
+
+	if p.graph != nil {
+		if !p.graphVerified {
+			reasons = append(reasons, "graph connectivity not verified")
+		} else if p.graphErr != nil {
+			reasons = append(reasons, fmt.Sprintf("graph unreachable: %v", p.graphErr))
+		}
+	}
+
+	return reasons
+}
+
+// Live returns the reasons the dispatchers are not alive anymore, i.e. a processor
+// stopped or the graph database is unreachable for longer than the threshold.
+func (p *Checker) Live() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	reasons := []string{}
+	for _, proc := range p.sorted() {
+		if proc.stopped {
+			reasons = append(reasons, fmt.Sprintf("processor %s stopped: %v", proc.name, proc.err))
+		}
+	}
+
+	if p.graph != nil && p.graphErr != nil {
+		since := p.lastReachable
+		if since.IsZero() {
+			since = p.started
+		}
+		if unreachable := time.Since(since); unreachable > p.unreachableThreshold {
+			reasons = append(reasons, fmt.Sprintf("graph unreachable for %s: %v",
+				unreachable.Round(time.Second), p.graphErr))
+		}
+	}
+
+	return reasons
+}
+
+func handler(check func() []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if reasons := check(); len(reasons) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, strings.Join(reasons, "\n"))
+			return
+		}
+
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// LiveHandler serves /healthz.
+func (p *Checker) LiveHandler() http.Handler {
+	return handler(p.Live)
+}
+
+// ReadyHandler serves /readyz.
+func (p *Checker) ReadyHandler() http.Handler {
+	return handler(p.Ready)
+}
@@ -0,0 +1,71 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/denkhaus/nksh/graphtest"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func status(h http.Handler) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	return rec.Code
+}
+
+func TestChecker(t *testing.T) {
+	client := graphtest.NewClient()
+	c := NewChecker(
+		WithGraphClient(client),
+		WithUnreachableThreshold(0),
+	)
+
+	input := c.RegisterProcessor("Person_Input")
+	hub := c.RegisterProcessor("Person_Hub")
+
+	recovered := false
+	input.Started(func() bool { return recovered })
+	assert.Equal(t, []string{
+		"processor Person_Hub not started",
+		"processor Person_Input recovering",
+		"graph connectivity not verified",
+	}, c.Ready())
+	assert.Equal(t, http.StatusServiceUnavailable, status(c.ReadyHandler()), "readiness")
+	assert.Equal(t, http.StatusOK, status(c.LiveHandler()), "liveness")
+
+	hub.Started(func() bool { return true })
+	recovered = true
+	assert.NoError(t, c.Ping(), "ping graph")
+	client.AssertExecuted(t, "RETURN 1", nil)
+	assert.Empty(t, c.Ready(), "ready")
+	assert.Equal(t, http.StatusOK, status(c.ReadyHandler()), "readiness")
+
+	client.OnQuery("RETURN 1").Fail(errors.New("unavailable"))
+	assert.Error(t, c.Ping(), "ping unreachable graph")
+	time.Sleep(time.Millisecond)
+	assert.Len(t, c.Ready(), 1, "graph unreachable")
+	assert.Len(t, c.Live(), 1, "graph unreachable beyond threshold")
+
+	hub.Stopped(errors.New("rebalance failed"))
+	assert.Len(t, c.Live(), 2, "processor stopped")
+	assert.Equal(t, http.StatusServiceUnavailable, status(c.LiveHandler()), "liveness")
+}
+
+func TestCheckerSameGroup(t *testing.T) {
+	c := NewChecker()
+	first := c.RegisterProcessor("Person_Input")
+	second := c.RegisterProcessor("Person_Input")
+
+	first.Started(func() bool { return true })
+	assert.Equal(t, []string{"processor Person_Input not started"}, c.Ready(), "tracked apart")
+
+	second.Started(func() bool { return true })
+	assert.Empty(t, c.Ready(), "ready")
+
+	first.Stopped(nil)
+	assert.Equal(t, []string{"processor Person_Input stopped: <nil>"}, c.Live())
+}
@@ -0,0 +1,61 @@
+package nksh
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// DefaultHTTPShutdownTimeout limits the time the runtime waits for open requests.
+	DefaultHTTPShutdownTimeout = 5 * time.Second
+)
+
+// endpoints holds the handlers the runtime serves, by listen address.
+type endpoints map[string]*http.ServeMux
+
+func (p endpoints) handle(addr, pattern string, handler http.Handler) {
+	mux, ok := p[addr]
+	if !ok {
+		mux = http.NewServeMux()
+		p[addr] = mux
+	}
+	mux.Handle(pattern, handler)
+}
+
+// serve listens on all addresses, the returned func shuts the servers down.
+func (p endpoints) serve(log logrus.FieldLogger) (func(), error) {
+	servers := []*http.Server{}
+	shutdown := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultHTTPShutdownTimeout)
+		defer cancel()
+		for _, srv := range servers {
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Error(errors.Annotate(err, "Shutdown"))
+			}
+		}
+	}
+
+	for addr, mux := range p {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			shutdown()
+			return nil, errors.Annotatef(err, "Listen [%s]", addr)
+		}
+
+		srv := &http.Server{Handler: mux}
+		servers = append(servers, srv)
+		go func(addr string) {
+			log.Infof("serving http endpoints on %s", addr)
+			if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				log.Error(errors.Annotatef(err, "Serve [%s]", addr))
+			}
+		}(addr)
+	}
+
+	return shutdown, nil
+}
@@ -1,6 +1,7 @@
 package hub
 
 import (
+	"github.com/denkhaus/nksh/expr"
 	"github.com/denkhaus/nksh/shared"
 	"github.com/juju/errors"
 	"github.com/lann/builder"
@@ -9,10 +10,19 @@ import (
 
 type ActionData struct {
 	EntityDescriptor shared.EntityDescriptor
+	GraphClient      shared.GraphClient
+	Metrics          shared.Metrics
+	KeyStrategy      shared.KeyStrategy
+	Name             string
+	Scope            string
+	Selector         string
+	TraceFunc        shared.TraceFunc
 	Sender           string
 	Operation        shared.Operation
 	Conditions       shared.EvalFuncs
+	Errors           []error
 	ErrorHandlers    shared.ErrorHandlers
+	Transactional    bool
 	Then             shared.Handlers
 	Else             shared.Handlers
 	Or               []ActionData
@@ -21,26 +31,61 @@ type ActionData struct {
 }
 
 func (p *ActionData) Match(m *shared.HubContext) bool {
-	result := m.Match(
-		p.Operation,
-		p.Sender,
-		p.Conditions,
-	)
-	for _, data := range p.Or {
-		result = result || data.Match(m)
+	return p.Evaluate(m, nil)
+}
+
+// err returns the first error recorded while building the chain or its branches.
+func (p *ActionData) err() error {
+	if len(p.Errors) > 0 {
+		return p.Errors[0]
+	}
+	for _, branches := range [][]ActionData{p.Or, p.And, p.Not} {
+		for _, data := range branches {
+			if err := data.err(); err != nil {
+				return err
+			}
+		}
 	}
-	for _, data := range p.And {
-		result = result && data.Match(m)
+	return nil
+}
+
+// Evaluate matches m like Match and records every evaluated
+// selector, condition and branch in trace, which may be nil.
+func (p *ActionData) Evaluate(m *shared.HubContext, trace *shared.Trace) bool {
+	eval := shared.Evaluation{
+		Selector:   p.Selector,
+		Conditions: p.Conditions,
+		Arg:        *m,
+		Match: func(conditions shared.EvalFuncs) bool {
+			return m.Match(
+				p.Operation,
+				p.Sender,
+				conditions,
+			)
+		},
+		Or:  branches(m, p.Or),
+		And: branches(m, p.And),
+		Not: branches(m, p.Not),
 	}
-	for _, data := range p.Not {
-		result = result && !data.Match(m)
+	return trace.Set(eval.Evaluate(trace))
+}
+
+func branches(m *shared.HubContext, data []ActionData) []shared.Branch {
+	res := make([]shared.Branch, 0, len(data))
+	for idx := range data {
+		d := &data[idx]
+		res = append(res, shared.Branch{
+			Selector: d.Selector,
+			Evaluate: func(trace *shared.Trace) bool { return d.Evaluate(m, trace) },
+		})
 	}
-	return result
+	return res
 }
 
 type Selectable interface {
 	From(sender string) Combinable
 	With(fn shared.EvalFunc) Combinable
+	WithExpr(src string) Combinable
 	OnNodeCreated() Combinable
 	OnNodeUpdated() Combinable
 	OnNodeDeleted() Combinable
@@ -50,14 +95,27 @@ type Combinable interface {
 	Or(or ...Combinable) Combinable
 	And(or ...Combinable) Combinable
 	Not(not ...Combinable) Combinable
+	// With adds fn to the conditions of the selector, which are
+	// matched before any Or, And and Not branch.
+	With(fn shared.EvalFunc) Combinable
 }
 type Catchable interface {
 	Catch(fn shared.ErrorHandler) Executable
 }
 
 type Executable interface {
+	Transactional() Executable
 	Execute(ctx goka.Context, m *shared.HubContext) shared.ChainHandledState
+	Run(ctx goka.Context, m *shared.HubContext) (shared.ChainHandledState, error)
 	SetDescriptor(descr shared.EntityDescriptor) Executable
+	SetGraphClient(client shared.GraphClient) Executable
+	Named(name string) Executable
+	Name() string
+	Scoped(label string) Executable
+	Scope() string
+	Trace(fn shared.TraceFunc) Executable
+	Explain(m *shared.HubContext) *shared.Trace
+	Err() error
 }
 
 type Proceedable interface {
@@ -71,26 +129,41 @@ type Alternative interface {
 
 type chain builder.Builder
 
+func (b chain) selector(name string, args ...string) interface{} {
+	return builder.Set(b, "Selector", shared.Selector(name, args...))
+}
+
 func (b chain) From(sender string) Combinable {
-	return builder.Set(b, "Sender", sender).(Combinable)
+	return builder.Set(b.selector("From", sender), "Sender", sender).(Combinable)
 }
 
 func (b chain) OnNodeCreated() Combinable {
-	return builder.Set(b, "Operation", shared.CreatedOperation).(Combinable)
+	return builder.Set(b.selector("OnNodeCreated"), "Operation", shared.CreatedOperation).(Combinable)
 }
 
 func (b chain) OnNodeUpdated() Combinable {
-	return builder.Set(b, "Operation", shared.UpdatedOperation).(Combinable)
+	return builder.Set(b.selector("OnNodeUpdated"), "Operation", shared.UpdatedOperation).(Combinable)
 }
 
 func (b chain) OnNodeDeleted() Combinable {
-	return builder.Set(b, "Operation", shared.DeletedOperation).(Combinable)
+	return builder.Set(b.selector("OnNodeDeleted"), "Operation", shared.DeletedOperation).(Combinable)
 }
 
 func (b chain) With(fn shared.EvalFunc) Combinable {
 	return builder.Append(b, "Conditions", fn).(Combinable)
 }
 
+// WithExpr adds the expression src as condition, see package expr.
+// If src does not compile the condition never matches, Err and Run return the compile error.
+func (b chain) WithExpr(src string) Combinable {
+	prog, err := expr.Compile(src, expr.HubEnv)
+	if err != nil {
+		b = builder.Append(b, "Errors", errors.Annotatef(err, "WithExpr [%s]", src)).(chain)
+		return b.With(func(arg interface{}) bool { return false })
+	}
+	return b.With(prog.Eval)
+}
+
 func (b chain) Or(or ...Combinable) Combinable {
 	data := []interface{}{}
 	for _, o := range or {
@@ -119,6 +192,16 @@ func (b chain) SetDescriptor(descr shared.EntityDescriptor) Executable {
 	return builder.Set(b, "EntityDescriptor", descr).(Executable)
 }
 
+// SetGraphClient sets the GraphClient the handlers of the chain run their cypher with.
+func (b chain) SetGraphClient(client shared.GraphClient) Executable {
+	return builder.Set(b, "GraphClient", client).(Executable)
+}
+
+// Transactional runs the handlers of the chain in a single Neo4j transaction.
+func (b chain) Transactional() Executable {
+	return builder.Set(b, "Transactional", true).(Executable)
+}
+
 func (b chain) Catch(fn shared.ErrorHandler) Executable {
 	return builder.Append(b, "ErrorHandlers", fn).(Executable)
 }
@@ -139,7 +222,51 @@ func (b chain) Else(fns ...shared.Handler) Catchable {
 	return builder.Append(b, "Else", data...).(Catchable)
 }
 
-func (b chain) handleError(err error) {
+// Named names the chain in logs, metrics and traces.
+func (b chain) Named(name string) Executable {
+	return builder.Set(b, "Name", name).(Executable)
+}
+
+func (b chain) Name() string {
+	if name, ok := builder.Get(b, "Name"); ok {
+		return name.(string)
+	}
+	return ""
+}
+
+// Scoped runs the chain only in the consumers of the descriptor with label
+// when it is part of a ChainSet.
+func (b chain) Scoped(label string) Executable {
+	return builder.Set(b, "Scope", label).(Executable)
+}
+
+func (b chain) Scope() string {
+	if scope, ok := builder.Get(b, "Scope"); ok {
+		return scope.(string)
+	}
+	return ""
+}
+
+// Trace passes the evaluation tree of every message the chain runs on to fn.
+func (b chain) Trace(fn shared.TraceFunc) Executable {
+	return builder.Set(b, "TraceFunc", fn).(Executable)
+}
+
+// Explain evaluates the chain for m without running any handler.
+func (b chain) Explain(m *shared.HubContext) *shared.Trace {
+	data := builder.GetStruct(b).(ActionData)
+	trace := shared.NewTrace(shared.TraceChain, data.Name)
+	data.Evaluate(m, trace)
+	return trace
+}
+
+// Err returns the first error recorded while building the chain, e.g. by WithExpr.
+func (b chain) Err() error {
+	data := builder.GetStruct(b).(ActionData)
+	return data.err()
+}
+
+func (b chain) handleError(err error) error {
 	if ehs, ok := builder.Get(b, "ErrorHandlers"); ok {
 		handlers := ehs.(shared.ErrorHandlers)
 		for _, handle := range handlers {
@@ -148,44 +275,66 @@ func (b chain) handleError(err error) {
 	} else {
 		panic(errors.Annotate(err, "HubChain: no catch handler found"))
 	}
+
+	return err
 }
 
 func (b chain) Execute(ctx goka.Context, m *shared.HubContext) shared.ChainHandledState {
+	state, _ := b.Run(ctx, m)
+	return state
+}
+
+// Run executes the chain like Execute and additionally returns the handled error.
+func (b chain) Run(ctx goka.Context, m *shared.HubContext) (shared.ChainHandledState, error) {
 	data := builder.GetStruct(b).(ActionData)
 	if len(data.Then) == 0 {
-		b.handleError(errors.New("HubChain: no handler defined"))
-		return shared.ChainHandledStateThenFailed
+		return shared.ChainHandledStateThenFailed,
+			b.handleError(errors.New("HubChain: no handler defined"))
+	}
+	if err := data.err(); err != nil {
+		return shared.ChainHandledStateThenFailed,
+			b.handleError(errors.Annotate(err, "HubChain: invalid chain"))
 	}
 
 	hCtx := shared.HandlerContext{
 		GokaContext:      ctx,
 		EntityDescriptor: data.EntityDescriptor,
+		GraphClient:      data.GraphClient,
+		Metrics:          data.Metrics,
+		KeyStrategy:      data.KeyStrategy,
+		Chain:            data.Name,
 		HubContext:       m,
 	}
 
-	if data.Match(m) {
-		for _, handle := range data.Then {
-			if err := handle(&hCtx); err != nil {
+	var trace *shared.Trace
+	if data.TraceFunc != nil {
+		trace = shared.NewTrace(shared.TraceChain, data.Name)
+	}
+
+	matched := data.Evaluate(m, trace)
+	if trace != nil {
+		data.TraceFunc(trace)
+	}
+
+	if matched {
+		if err := shared.ExecuteHandlers(&hCtx, data.Then, data.Transactional); err != nil {
+			return shared.ChainHandledStateThenFailed,
 				b.handleError(errors.Annotate(err, "HandleEvent [then]"))
-				return shared.ChainHandledStateThenFailed
-			}
 		}
 
-		return shared.ChainHandledStateThen
+		return shared.ChainHandledStateThen, nil
 	}
 
 	if len(data.Else) == 0 {
-		return shared.ChainHandledStateUnhandled
+		return shared.ChainHandledStateUnhandled, nil
 	}
 
-	for _, handle := range data.Else {
-		if err := handle(&hCtx); err != nil {
+	if err := shared.ExecuteHandlers(&hCtx, data.Else, data.Transactional); err != nil {
+		return shared.ChainHandledStateElseFailed,
 			b.handleError(errors.Annotate(err, "HandleEvent [else]"))
-			return shared.ChainHandledStateElseFailed
-		}
 	}
 
-	return shared.ChainHandledStateElse
+	return shared.ChainHandledStateElse, nil
 }
 
 var actionChain = builder.Register(chain{}, ActionData{})
@@ -208,3 +357,6 @@ func From(sender string) Combinable {
 func With(fn shared.EvalFunc) Combinable {
 	return actionChain.(Selectable).With(fn)
 }
+func WithExpr(src string) Combinable {
+	return actionChain.(Selectable).WithExpr(src)
+}
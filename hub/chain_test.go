@@ -76,3 +76,32 @@ func TestChain(t *testing.T) {
 	assert.Equal(t, 1, thenTriggered, "then triggered")
 	assert.Equal(t, shared.ChainHandledStateThen, state, "condition hit")
 }
+
+func TestExplain(t *testing.T) {
+	m, err := new(shared.HubContextCodec).Decode([]byte(update))
+	assert.NoError(t, err, "decode raw message")
+
+	chain := If(
+		OnNodeUpdated().And(
+			From("Person").Or(From("Photo")),
+		).Not(
+			With(IsNodeInvisible),
+		),
+	).Then(func(_ *shared.HandlerContext) error {
+		return nil
+	}).Catch(func(err error) {
+		assert.NoError(t, err, "handled error")
+	}).Named("visibility")
+
+	trace := chain.Explain(m.(*shared.HubContext))
+	assert.False(t, trace.Result, "chain result")
+	assert.Equal(t, `chain visibility: false
+  selector OnNodeUpdated: true
+  and From(Person): true
+    selector From(Person): false
+    or From(Photo): true
+      selector From(Photo): true
+  not: true
+    with #0: true
+`, trace.String())
+}
@@ -2,22 +2,42 @@ package hub
 
 import (
 	"context"
+	"time"
 
 	"github.com/denkhaus/nksh/shared"
 	"github.com/juju/errors"
 	"github.com/lovoo/goka"
-	"github.com/lovoo/goka/kafka"
 )
 
-func handleHubEvents(ctx goka.Context, msg interface{}, exes ...Executable) error {
+func handleHubEvents(ctx goka.Context, msg interface{}, descr shared.EntityDescriptor, metrics shared.Metrics, exes ...Executable) error {
 	m, ok := msg.(*shared.HubContext)
 	if !ok {
+		metrics.DecodeFailed(shared.LabelOf(descr), ctx.Topic())
 		return errors.Errorf("invalid message type %+v", msg)
 	}
 
+	metrics.MessageConsumed(shared.LabelOf(descr), ctx.Topic())
 	for _, exe := range exes {
-		if state := exe.Execute(ctx, m); state.Failed() {
-			log.Warningf("unhandled hub msg [%s]: %+v", state, m)
+		// a retried message runs the chain it failed on only
+		if m.Chain != "" && m.Chain != exe.Name() {
+			continue
+		}
+
+		start := time.Now()
+		state, err := exe.Run(ctx, m)
+		metrics.ChainHandled(shared.LabelOf(descr), exe.Name(), state, time.Since(start))
+		if !state.Failed() {
+			continue
+		}
+
+		log.Warningf("unhandled hub msg [%s] by chain %s: %+v", state, exe.Name(), m)
+		if shared.RoutesFailures(descr) {
+			failed := *m
+			failed.Chain = exe.Name()
+			failed.Attempt = m.Attempt + 1
+			if err := shared.RouteFailure(ctx, descr, failed.Chain, failed.Attempt, &failed, state, err); err != nil {
+				return errors.Annotate(err, "RouteFailure")
+			}
 		}
 	}
 
@@ -26,41 +46,66 @@ func handleHubEvents(ctx goka.Context, msg interface{}, exes ...Executable) erro
 
 // receives dedicated hub messages, sends hub messages
 func CreateConsumerDefaults(descr shared.EntityDescriptor, execs ...Executable) shared.DispatcherFunc {
-	exe := []Executable{}
-	for _, exec := range execs {
-		exe = append(exe, exec.SetDescriptor(descr))
-	}
-	return CreateConsumer(
+	return CreateChainSetConsumerDefaults(descr, NewChainSet(execs...))
+}
+
+// CreateChainSetConsumerDefaults runs the chains of set, which may be replaced while the consumer is running.
+func CreateChainSetConsumerDefaults(descr shared.EntityDescriptor, set *ChainSet) shared.DispatcherFunc {
+	return createConsumer(
+		descr,
 		descr.HubGroup(),
 		descr.HubInputStream(),
 		descr.HubOutputStream(),
-		exe...,
+		set,
 	)
 }
 
 func CreateConsumer(group goka.Group, inputStream, outputStream goka.Stream, execs ...Executable) shared.DispatcherFunc {
+	return createConsumer(nil, group, inputStream, outputStream, NewChainSet(execs...))
+}
+
+// CreateChainSetConsumer runs the chains of set, which may be replaced while the consumer is running.
+func CreateChainSetConsumer(group goka.Group, inputStream, outputStream goka.Stream, set *ChainSet) shared.DispatcherFunc {
+	return createConsumer(nil, group, inputStream, outputStream, set)
+}
+
+// failed messages are routed according to the RetryPolicy of descr, if descr is not nil
+func createConsumer(descr shared.EntityDescriptor, group goka.Group, inputStream, outputStream goka.Stream, set *ChainSet) shared.DispatcherFunc {
 	return func(ctx context.Context, kServers, zServers []string) func() error {
+		health := shared.RegisterProcessor(ctx, group)
+		chains := shared.NewPreparedChains(ctx, descr, set, []Executable(nil))
+		metrics := shared.MetricsFromContext(ctx)
 		return func() error {
-			g := goka.DefineGroup(group,
+			edges := []goka.Edge{
 				goka.Input(inputStream, new(shared.HubContextCodec), func(ctx goka.Context, msg interface{}) {
-					if err := handleHubEvents(ctx, msg, execs...); err != nil {
+					if err := handleHubEvents(ctx, msg, descr, metrics, chains.Load().([]Executable)...); err != nil {
 						log.Error(errors.Annotate(err, "handleHubEvents"))
 					}
 				}),
 				goka.Output(outputStream, new(shared.HubContextCodec)),
-			)
+			}
+
+			if shared.RoutesFailures(descr) {
+				edges = append(edges,
+					goka.Output(descr.RetryStream(), new(shared.FailedMessageCodec)),
+					goka.Output(descr.DeadLetterStream(), new(shared.FailedMessageCodec)),
+				)
+			}
 
+			g := goka.DefineGroup(group, edges...)
 			p, err := goka.NewProcessor(kServers, g,
-				goka.WithTopicManagerBuilder(
-					kafka.ZKTopicManagerBuilder(zServers),
-				),
+				shared.ProcessorOptions(ctx,
+					goka.WithTopicManagerBuilder(
+						shared.TopicManagerBuilder(ctx, zServers),
+					),
+				)...,
 			)
 			if err != nil {
 				return errors.Annotate(err, "NewProcessor")
 			}
 
-			if err := p.Run(ctx); err != nil {
-				return errors.Annotate(err, "Run")
+			if err := shared.RunProcessor(ctx, health, p); err != nil {
+				return errors.Annotate(err, "RunProcessor")
 			}
 
 			return nil
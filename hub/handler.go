@@ -1,7 +1,9 @@
 package hub
 
 import (
+	"github.com/denkhaus/nksh/predicate"
 	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
 )
 
 func SetVisibility(visible bool) shared.Handler {
@@ -16,7 +18,25 @@ func SetVisibility(visible bool) shared.Handler {
 	}
 }
 
+// LoadEntityContext loads the EntityContext of the receiver node,
+// subsequent handlers get it by HandlerContext.GetEntityContext.
+func LoadEntityContext() shared.Handler {
+	return func(ctx *shared.HandlerContext) error {
+		exec := shared.NewExecutor(ctx)
+		entityCtx, err := exec.BuildEntityContext(
+			ctx.HubContext.ReceiverID,
+		)
+		if err != nil {
+			return errors.Annotate(err, "BuildEntityContext")
+		}
+
+		ctx.Set("EntityContext", entityCtx)
+		return nil
+	}
+}
+
+var isNodeInvisible = predicate.FieldEquals("visible", false)
+
 func IsNodeInvisible(arg interface{}) bool {
-	ctx := arg.(shared.HubContext)
-	return ctx.Properties.MustBool("visible") == false
+	return isNodeInvisible(arg)
 }
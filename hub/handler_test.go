@@ -0,0 +1,47 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/denkhaus/nksh/graphtest"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetVisibility(t *testing.T) {
+	client := graphtest.NewClient()
+	m := &shared.HubContext{
+		Sender:     "Person",
+		Receiver:   "PersonConnector",
+		ReceiverID: 7,
+		Operation:  shared.UpdatedOperation,
+	}
+
+	exe := If(OnNodeUpdated()).
+		Then(SetVisibility(false)).
+		Catch(func(err error) {}).
+		Transactional().
+		SetGraphClient(client)
+
+	state, err := exe.Run(nil, m)
+	assert.NoError(t, err, "run chain")
+	assert.Equal(t, shared.ChainHandledStateThen, state, "handled state")
+
+	q := client.AssertExecuted(t, "SET p+= $ctx", map[string]interface{}{
+		"id": int64(7),
+	})
+	assert.True(t, q.Tx, "query in transaction")
+	assert.Equal(t, shared.Properties{"visible": false}, q.Params["ctx"], "applied properties")
+	assert.Equal(t, 1, client.Commits(), "commits")
+
+	client.Reset()
+	client.OnQuery("SET p+= $ctx").Fail(errors.New("unavailable"))
+
+	state, err = exe.Run(nil, m)
+	assert.Error(t, err, "run failing chain")
+	assert.Equal(t, shared.ChainHandledStateThenFailed, state, "handled state")
+	assert.Equal(t, 0, client.Commits(), "commits")
+	assert.Equal(t, 1, client.Rollbacks(), "rollbacks")
+	assert.Equal(t, 0, client.OpenSessions(), "open sessions")
+}
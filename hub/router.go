@@ -0,0 +1,87 @@
+package hub
+
+import (
+	"context"
+
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/lovoo/goka"
+)
+
+type routes map[string]goka.Stream
+
+func newRoutes(descrs ...shared.EntityDescriptor) routes {
+	r := make(routes)
+	for _, descr := range descrs {
+		r[descr.Label()] = descr.HubInputStream()
+	}
+
+	return r
+}
+
+func routeHubEvents(ctx goka.Context, msg interface{}, r routes, keys shared.KeyStrategy, metrics shared.Metrics) error {
+	m, ok := msg.(*shared.HubContext)
+	if !ok {
+		metrics.DecodeFailed("", ctx.Topic())
+		return errors.Errorf("invalid message type %+v", msg)
+	}
+
+	stream, ok := r[m.Receiver]
+	if !ok {
+		metrics.MessageUnroutable(m.Receiver, ctx.Topic())
+		log.Warningf("no route for hub msg receiver %q", m.Receiver)
+		return nil
+	}
+
+	ctx.Emit(stream, keys.Key(m.Receiver, m.ReceiverID), m)
+	return nil
+}
+
+// receives hub messages, sends dedicated hub messages
+func CreateRouterDefaults(descrs ...shared.EntityDescriptor) shared.DispatcherFunc {
+	return CreateRouter(shared.HubGroup, shared.HubStream, descrs...)
+}
+
+// CreateRouter forwards each HubContext from inputStream to the HubInputStream of the
+// descriptor labeled HubContext.Receiver. Messages for unknown receivers are dropped and
+// reported as MessageUnroutable to the Metrics of the dispatcher context.
+func CreateRouter(group goka.Group, inputStream goka.Stream, descrs ...shared.EntityDescriptor) shared.DispatcherFunc {
+	return func(ctx context.Context, kServers, zServers []string) func() error {
+		health := shared.RegisterProcessor(ctx, group)
+		return func() error {
+			r := newRoutes(descrs...)
+			keys := shared.KeyStrategyFromContext(ctx)
+			metrics := shared.MetricsFromContext(ctx)
+			edges := []goka.Edge{
+				goka.Input(inputStream, new(shared.HubContextCodec), func(ctx goka.Context, msg interface{}) {
+					metrics.MessageConsumed("", inputStream)
+					if err := routeHubEvents(ctx, msg, r, keys, metrics); err != nil {
+						log.Error(errors.Annotate(err, "routeHubEvents"))
+					}
+				}),
+			}
+
+			for _, stream := range r {
+				edges = append(edges, goka.Output(stream, new(shared.HubContextCodec)))
+			}
+
+			g := goka.DefineGroup(group, edges...)
+			p, err := goka.NewProcessor(kServers, g,
+				shared.ProcessorOptions(ctx,
+					goka.WithTopicManagerBuilder(
+						shared.TopicManagerBuilder(ctx, zServers),
+					),
+				)...,
+			)
+			if err != nil {
+				return errors.Annotate(err, "NewProcessor")
+			}
+
+			if err := shared.RunProcessor(ctx, health, p); err != nil {
+				return errors.Annotate(err, "RunProcessor")
+			}
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/denkhaus/nksh/graphtest"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/lovoo/goka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter(t *testing.T) {
+	codec := shared.HubContextCodec{}
+	m, err := codec.Decode([]byte(update))
+	assert.NoError(t, err, "decode raw message")
+
+	r := newRoutes(
+		graphtest.NewDescriptor("PersonConnector"),
+		graphtest.NewDescriptor("Person"),
+	)
+
+	metrics := graphtest.NewMetrics()
+	ctx := graphtest.NewContext(shared.HubStream, "PersonConnector-7")
+
+	assert.NoError(t, routeHubEvents(ctx, m, r, shared.NodeAffineKeys, metrics), "route message")
+	assert.Equal(t, []goka.Stream{"Hub2PersonConnector"}, ctx.Streams(), "routed streams")
+
+	m.(*shared.HubContext).Receiver = "Unknown"
+	assert.NoError(t, routeHubEvents(ctx, m, r, shared.NodeAffineKeys, metrics), "route unknown receiver")
+	assert.Len(t, ctx.Emits, 1, "routed streams")
+
+	assert.Error(t, routeHubEvents(ctx, "invalid", r, shared.NodeAffineKeys, metrics), "route invalid message")
+	assert.Equal(t, 1, metrics.Count("DecodeFailed"), "decode failures")
+	assert.Equal(t, 1, metrics.Count("MessageUnroutable"), "unroutable messages")
+}
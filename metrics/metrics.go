@@ -0,0 +1,119 @@
+// Package metrics implements shared.Metrics with prometheus.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/lovoo/goka"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	Namespace = "nksh"
+)
+
+// Prometheus records the measurements of consumers and executors as prometheus series.
+type Prometheus struct {
+	consumed       *prometheus.CounterVec
+	decodeFailures *prometheus.CounterVec
+	unroutable     *prometheus.CounterVec
+	handled        *prometheus.CounterVec
+	handlerLatency *prometheus.HistogramVec
+	queryLatency   *prometheus.HistogramVec
+	queryFailures  *prometheus.CounterVec
+}
+
+// NewPrometheus registers the nksh series with reg.
+func NewPrometheus(reg prometheus.Registerer) (*Prometheus, error) {
+	p := Prometheus{
+		consumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "messages_consumed_total",
+			Help:      "Number of consumed messages.",
+		}, []string{"label", "stream"}),
+		decodeFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "decode_errors_total",
+			Help:      "Number of messages which could not be decoded.",
+		}, []string{"label", "stream"}),
+		unroutable: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "messages_unroutable_total",
+			Help:      "Number of messages dropped for lack of a route to their receiver.",
+		}, []string{"receiver", "stream"}),
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "chain_handled_total",
+			Help:      "Number of chain executions by handled state.",
+		}, []string{"label", "chain", "state"}),
+		handlerLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "handler_duration_seconds",
+			Help:      "Duration of chain executions running handlers.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"label", "chain"}),
+		queryLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "cypher_query_duration_seconds",
+			Help:      "Duration of cypher queries run by the executor.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"label", "chain"}),
+		queryFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "cypher_query_errors_total",
+			Help:      "Number of failed cypher queries run by the executor.",
+		}, []string{"label", "chain"}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		p.consumed,
+		p.decodeFailures,
+		p.unroutable,
+		p.handled,
+		p.handlerLatency,
+		p.queryLatency,
+		p.queryFailures,
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, errors.Annotate(err, "Register")
+		}
+	}
+
+	return &p, nil
+}
+
+func (p *Prometheus) MessageConsumed(label string, stream goka.Stream) {
+	p.consumed.WithLabelValues(label, string(stream)).Inc()
+}
+
+func (p *Prometheus) DecodeFailed(label string, stream goka.Stream) {
+	p.decodeFailures.WithLabelValues(label, string(stream)).Inc()
+}
+
+func (p *Prometheus) MessageUnroutable(receiver string, stream goka.Stream) {
+	p.unroutable.WithLabelValues(receiver, string(stream)).Inc()
+}
+
+// ChainHandled counts every execution, but observes the latency only if handlers ran.
+func (p *Prometheus) ChainHandled(label, chain string, state shared.ChainHandledState, duration time.Duration) {
+	p.handled.WithLabelValues(label, chain, state.String()).Inc()
+	if state != shared.ChainHandledStateUnhandled {
+		p.handlerLatency.WithLabelValues(label, chain).Observe(duration.Seconds())
+	}
+}
+
+func (p *Prometheus) QueryExecuted(label, chain string, duration time.Duration, err error) {
+	p.queryLatency.WithLabelValues(label, chain).Observe(duration.Seconds())
+	if err != nil {
+		p.queryFailures.WithLabelValues(label, chain).Inc()
+	}
+}
+
+// Handler returns the /metrics handler exposing the series of gatherer.
+func Handler(gatherer prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/denkhaus/nksh/graphtest"
+	"github.com/denkhaus/nksh/hub"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/denkhaus/nksh/testharness"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheus(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := NewPrometheus(reg)
+	assert.NoError(t, err, "register metrics")
+
+	person := graphtest.NewDescriptor("Person")
+	h := testharness.New(t,
+		testharness.WithMetrics(m),
+		testharness.WithGraphClient(graphtest.NewClient()),
+	)
+
+	err = h.Start(
+		hub.CreateConsumerDefaults(person,
+			hub.If(hub.OnNodeUpdated()).
+				Then(hub.SetVisibility(true)).
+				Catch(func(err error) {}),
+			hub.If(hub.OnNodeDeleted()).
+				Then(hub.SetVisibility(false)).
+				Catch(func(err error) {}),
+		),
+	)
+	assert.NoError(t, err, "start harness")
+
+	h.Consume(person.HubInputStream(), "Person:1", &shared.HubContext{
+		Sender:     "PersonConnector",
+		Receiver:   "Person",
+		ReceiverID: 1,
+		Operation:  shared.UpdatedOperation,
+	})
+	assert.NoError(t, h.Stop(), "stop harness")
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(
+		m.consumed.WithLabelValues("Person", "Hub2Person"),
+	), "consumed messages")
+	assert.Equal(t, float64(1), testutil.ToFloat64(
+		m.handled.WithLabelValues("Person", "0", "ChainHandledStateThen"),
+	), "then handled")
+	assert.Equal(t, float64(1), testutil.ToFloat64(
+		m.handled.WithLabelValues("Person", "1", "ChainHandledStateUnhandled"),
+	), "unhandled")
+
+	m.MessageUnroutable("Unknown", shared.HubStream)
+	assert.Equal(t, float64(1), testutil.ToFloat64(
+		m.unroutable.WithLabelValues("Unknown", string(shared.HubStream)),
+	), "unroutable messages")
+
+	families, err := reg.Gather()
+	assert.NoError(t, err, "gather metrics")
+
+	counts := map[string]uint64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			if hist := metric.GetHistogram(); hist != nil {
+				counts[family.GetName()] += hist.GetSampleCount()
+			}
+		}
+	}
+
+	assert.Equal(t, uint64(1), counts["nksh_handler_duration_seconds"], "handler latency samples")
+	assert.Equal(t, uint64(1), counts["nksh_cypher_query_duration_seconds"], "query latency samples")
+}
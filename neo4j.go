@@ -2,7 +2,6 @@ package nksh
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/denkhaus/nksh/shared"
 
@@ -10,23 +9,23 @@ import (
 	"github.com/neo4j/neo4j-go-driver/neo4j"
 )
 
+// ConnectNeo4j connects to bolt://<host>:7687 with the credentials
+// of the NEO4J_USERNAME and NEO4J_PASSWORD environment variables.
 func ConnectNeo4j(host string) error {
-	log.Info("connect neo4j")
-
-	user := os.Getenv("NEO4J_USERNAME")
-	if user == "" {
-		return errors.New("Neo4j username undefined")
+	cfg, err := Neo4jConfigFromEnv()
+	if err != nil {
+		return errors.Annotate(err, "Neo4jConfigFromEnv")
 	}
 
-	password := os.Getenv("NEO4J_PASSWORD")
-	if password == "" {
-		return errors.New("Neo4j password undefined")
-	}
+	cfg.URI = fmt.Sprintf("bolt://%s:7687", host)
+	cfg.Auth = AuthBasic
+	return ConnectNeo4jWithConfig(cfg)
+}
 
-	driver, err := neo4j.NewDriver(fmt.Sprintf("bolt://%s:7687", host),
-		neo4j.BasicAuth(user, password, ""),
-	)
+func ConnectNeo4jWithConfig(cfg *Neo4jConfig) error {
+	log.Info("connect neo4j")
 
+	driver, err := cfg.NewDriver()
 	if err != nil {
 		return errors.Annotate(err, "NewDriver")
 	}
@@ -0,0 +1,300 @@
+package nksh
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+	yaml "gopkg.in/yaml.v3"
+)
+
+var (
+	AuthNone     = "none"
+	AuthBasic    = "basic"
+	AuthKerberos = "kerberos"
+	AuthBearer   = "bearer"
+)
+
+var (
+	TrustAny    = "any"    // accept any certificate
+	TrustSystem = "system" // accept certificates signed by a system CA
+	TrustCA     = "ca"     // accept certificates signed by CACertFile only
+)
+
+// Neo4jConfig describes the connection to Neo4j. URI supports the schemes bolt and
+// neo4j, the latter for routing, each with the suffixes +s (encrypted, system trust)
+// and +ssc (encrypted, any certificate). Encrypted and Trust are left to the driver
+// defaults, encrypted and any certificate, unless configured.
+type Neo4jConfig struct {
+	URI                          string        `yaml:"uri"`
+	Auth                         string        `yaml:"auth"`
+	Username                     string        `yaml:"username"`
+	Password                     string        `yaml:"password"`
+	Realm                        string        `yaml:"realm"`
+	Ticket                       string        `yaml:"ticket"`
+	Token                        string        `yaml:"token"`
+	Encrypted                    *bool         `yaml:"encrypted"`
+	Trust                        string        `yaml:"trust"`
+	VerifyHostname               bool          `yaml:"verify_hostname"`
+	CACertFile                   string        `yaml:"ca_cert_file"`
+	MaxConnectionPoolSize        int           `yaml:"max_connection_pool_size"`
+	ConnectionAcquisitionTimeout time.Duration `yaml:"connection_acquisition_timeout"`
+	MaxTransactionRetryTime      time.Duration `yaml:"max_transaction_retry_time"`
+}
+
+func DefaultNeo4jConfig() *Neo4jConfig {
+	cfg := Neo4jConfig{
+		URI:                          "bolt://localhost:7687",
+		Auth:                         AuthBasic,
+		MaxConnectionPoolSize:        100,
+		ConnectionAcquisitionTimeout: time.Minute,
+		MaxTransactionRetryTime:      30 * time.Second,
+	}
+	return &cfg
+}
+
+// LoadNeo4jConfig reads a YAML or JSON file on top of DefaultNeo4jConfig.
+func LoadNeo4jConfig(path string) (*Neo4jConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotate(err, "ReadFile")
+	}
+
+	cfg := DefaultNeo4jConfig()
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return nil, errors.Annotate(err, "Decode")
+	}
+
+	return cfg, nil
+}
+
+// Neo4jConfigFromEnv reads the NEO4J_* environment variables on top of DefaultNeo4jConfig.
+func Neo4jConfigFromEnv() (*Neo4jConfig, error) {
+	cfg := DefaultNeo4jConfig()
+
+	strs := map[string]*string{
+		"NEO4J_URI":          &cfg.URI,
+		"NEO4J_AUTH":         &cfg.Auth,
+		"NEO4J_USERNAME":     &cfg.Username,
+		"NEO4J_PASSWORD":     &cfg.Password,
+		"NEO4J_REALM":        &cfg.Realm,
+		"NEO4J_TICKET":       &cfg.Ticket,
+		"NEO4J_TOKEN":        &cfg.Token,
+		"NEO4J_TRUST":        &cfg.Trust,
+		"NEO4J_CA_CERT_FILE": &cfg.CACertFile,
+	}
+	for name, field := range strs {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+
+	if value, ok := os.LookupEnv("NEO4J_ENCRYPTED"); ok {
+		encrypted, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.Annotate(err, "ParseBool [NEO4J_ENCRYPTED]")
+		}
+		cfg.Encrypted = &encrypted
+	}
+
+	if value, ok := os.LookupEnv("NEO4J_VERIFY_HOSTNAME"); ok {
+		verify, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.Annotate(err, "ParseBool [NEO4J_VERIFY_HOSTNAME]")
+		}
+		cfg.VerifyHostname = verify
+	}
+
+	durations := map[string]*time.Duration{
+		"NEO4J_CONNECTION_ACQUISITION_TIMEOUT": &cfg.ConnectionAcquisitionTimeout,
+		"NEO4J_MAX_TRANSACTION_RETRY_TIME":     &cfg.MaxTransactionRetryTime,
+	}
+	for name, field := range durations {
+		if value, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, errors.Annotatef(err, "ParseDuration [%s]", name)
+			}
+			*field = d
+		}
+	}
+
+	if value, ok := os.LookupEnv("NEO4J_MAX_CONNECTION_POOL_SIZE"); ok {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.Annotate(err, "Atoi [NEO4J_MAX_CONNECTION_POOL_SIZE]")
+		}
+		cfg.MaxConnectionPoolSize = size
+	}
+
+	return cfg, nil
+}
+
+func (p *Neo4jConfig) authToken() (neo4j.AuthToken, error) {
+	switch p.Auth {
+	case AuthNone:
+		return neo4j.NoAuth(), nil
+	case AuthBasic, "":
+		if p.Username == "" {
+			return neo4j.AuthToken{}, errors.New("Neo4j username undefined")
+		}
+		if p.Password == "" {
+			return neo4j.AuthToken{}, errors.New("Neo4j password undefined")
+		}
+		return neo4j.BasicAuth(p.Username, p.Password, p.Realm), nil
+	case AuthKerberos:
+		if p.Ticket == "" {
+			return neo4j.AuthToken{}, errors.New("Neo4j kerberos ticket undefined")
+		}
+		return neo4j.KerberosAuth(p.Ticket), nil
+	case AuthBearer:
+		if p.Token == "" {
+			return neo4j.AuthToken{}, errors.New("Neo4j bearer token undefined")
+		}
+		return neo4j.CustomAuth("bearer", "", p.Token, "", nil), nil
+	default:
+		return neo4j.AuthToken{}, errors.Errorf("invalid auth type %q", p.Auth)
+	}
+}
+
+func (p *Neo4jConfig) trustStrategy() (neo4j.TrustStrategy, error) {
+	switch p.Trust {
+	case TrustAny, "":
+		return neo4j.TrustAny(p.VerifyHostname), nil
+	case TrustSystem:
+		return neo4j.TrustSystem(p.VerifyHostname), nil
+	case TrustCA:
+		data, err := ioutil.ReadFile(p.CACertFile)
+		if err != nil {
+			return neo4j.TrustStrategy{}, errors.Annotate(err, "ReadFile [ca cert]")
+		}
+
+		certs, err := parseCertificates(data)
+		if err != nil {
+			return neo4j.TrustStrategy{}, errors.Annotate(err, "parseCertificates")
+		}
+		if len(certs) == 0 {
+			return neo4j.TrustStrategy{}, errors.Errorf("no certificates in %s", p.CACertFile)
+		}
+
+		return neo4j.TrustOnly(p.VerifyHostname, certs...), nil
+	default:
+		return neo4j.TrustStrategy{}, errors.Errorf("invalid trust strategy %q", p.Trust)
+	}
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Annotate(err, "ParseCertificate")
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// driverURI maps the URI to a scheme supported by the driver and applies the
+// encryption and trust implied by the scheme suffix. A suffix contradicting
+// an explicitly configured encryption or trust is an error.
+func (p *Neo4jConfig) driverURI() (string, error) {
+	u, err := url.Parse(p.URI)
+	if err != nil {
+		return "", errors.Annotate(err, "Parse")
+	}
+
+	scheme, trust := u.Scheme, ""
+	switch {
+	case strings.HasSuffix(scheme, "+ssc"):
+		scheme, trust = strings.TrimSuffix(scheme, "+ssc"), TrustAny
+	case strings.HasSuffix(scheme, "+s"):
+		scheme, trust = strings.TrimSuffix(scheme, "+s"), TrustSystem
+	}
+
+	if trust != "" {
+		if p.Encrypted != nil && !*p.Encrypted {
+			return "", errors.Errorf("uri scheme %q conflicts with encrypted false", u.Scheme)
+		}
+		if p.Trust != "" && p.Trust != trust {
+			return "", errors.Errorf("uri scheme %q conflicts with trust %q", u.Scheme, p.Trust)
+		}
+
+		encrypted := true
+		p.Encrypted, p.Trust = &encrypted, trust
+	}
+
+	switch scheme {
+	case "bolt", "bolt+routing":
+	case "neo4j":
+		scheme = "bolt+routing"
+	default:
+		return "", errors.Errorf("unsupported uri scheme %q", u.Scheme)
+	}
+
+	u.Scheme = scheme
+	return u.String(), nil
+}
+
+func (p *Neo4jConfig) NewDriver() (neo4j.Driver, error) {
+	// the uri scheme may override encryption and trust of the copy
+	cfg := *p
+	return cfg.newDriver()
+}
+
+func (p *Neo4jConfig) newDriver() (neo4j.Driver, error) {
+	uri, err := p.driverURI()
+	if err != nil {
+		return nil, errors.Annotate(err, "driverURI")
+	}
+
+	token, err := p.authToken()
+	if err != nil {
+		return nil, errors.Annotate(err, "authToken")
+	}
+
+	trust, err := p.trustStrategy()
+	if err != nil {
+		return nil, errors.Annotate(err, "trustStrategy")
+	}
+
+	driver, err := neo4j.NewDriver(uri, token, func(config *neo4j.Config) {
+		if p.Encrypted != nil {
+			config.Encrypted = *p.Encrypted
+		}
+		config.TrustStrategy = trust
+		if p.MaxConnectionPoolSize != 0 {
+			config.MaxConnectionPoolSize = p.MaxConnectionPoolSize
+		}
+		if p.ConnectionAcquisitionTimeout != 0 {
+			config.ConnectionAcquisitionTimeout = p.ConnectionAcquisitionTimeout
+		}
+		if p.MaxTransactionRetryTime != 0 {
+			config.MaxTransactionRetryTime = p.MaxTransactionRetryTime
+		}
+	})
+	if err != nil {
+		return nil, errors.Annotate(err, "NewDriver")
+	}
+
+	return driver, nil
+}
@@ -0,0 +1,317 @@
+package nksh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+	"github.com/stretchr/testify/assert"
+)
+
+var neo4jEnv = []string{
+	"NEO4J_URI", "NEO4J_AUTH", "NEO4J_USERNAME", "NEO4J_PASSWORD", "NEO4J_REALM",
+	"NEO4J_TICKET", "NEO4J_TOKEN", "NEO4J_TRUST", "NEO4J_CA_CERT_FILE",
+	"NEO4J_ENCRYPTED", "NEO4J_VERIFY_HOSTNAME", "NEO4J_MAX_CONNECTION_POOL_SIZE",
+	"NEO4J_CONNECTION_ACQUISITION_TIMEOUT", "NEO4J_MAX_TRANSACTION_RETRY_TIME",
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestNeo4jConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want func(cfg *Neo4jConfig)
+		err  string
+	}{
+		{name: "defaults", want: func(cfg *Neo4jConfig) {}},
+		{
+			name: "strings",
+			env: map[string]string{
+				"NEO4J_URI":          "neo4j+s://db:7687",
+				"NEO4J_AUTH":         AuthBearer,
+				"NEO4J_USERNAME":     "user",
+				"NEO4J_PASSWORD":     "secret",
+				"NEO4J_REALM":        "realm",
+				"NEO4J_TICKET":       "ticket",
+				"NEO4J_TOKEN":        "token",
+				"NEO4J_TRUST":        TrustCA,
+				"NEO4J_CA_CERT_FILE": "/etc/ca.pem",
+			},
+			want: func(cfg *Neo4jConfig) {
+				cfg.URI, cfg.Auth, cfg.Username, cfg.Password = "neo4j+s://db:7687", AuthBearer, "user", "secret"
+				cfg.Realm, cfg.Ticket, cfg.Token = "realm", "ticket", "token"
+				cfg.Trust, cfg.CACertFile = TrustCA, "/etc/ca.pem"
+			},
+		},
+		{
+			name: "encrypted",
+			env:  map[string]string{"NEO4J_ENCRYPTED": "true", "NEO4J_VERIFY_HOSTNAME": "1"},
+			want: func(cfg *Neo4jConfig) { cfg.Encrypted, cfg.VerifyHostname = boolPtr(true), true },
+		},
+		{
+			name: "unencrypted",
+			env:  map[string]string{"NEO4J_ENCRYPTED": "false"},
+			want: func(cfg *Neo4jConfig) { cfg.Encrypted = boolPtr(false) },
+		},
+		{
+			name: "pool",
+			env: map[string]string{
+				"NEO4J_MAX_CONNECTION_POOL_SIZE":       "10",
+				"NEO4J_CONNECTION_ACQUISITION_TIMEOUT": "5s",
+				"NEO4J_MAX_TRANSACTION_RETRY_TIME":     "1m",
+			},
+			want: func(cfg *Neo4jConfig) {
+				cfg.MaxConnectionPoolSize = 10
+				cfg.ConnectionAcquisitionTimeout = 5 * time.Second
+				cfg.MaxTransactionRetryTime = time.Minute
+			},
+		},
+		{name: "invalid encrypted", env: map[string]string{"NEO4J_ENCRYPTED": "maybe"}, err: "ParseBool [NEO4J_ENCRYPTED]"},
+		{name: "invalid verify", env: map[string]string{"NEO4J_VERIFY_HOSTNAME": "maybe"}, err: "ParseBool [NEO4J_VERIFY_HOSTNAME]"},
+		{name: "invalid pool", env: map[string]string{"NEO4J_MAX_CONNECTION_POOL_SIZE": "many"}, err: "Atoi [NEO4J_MAX_CONNECTION_POOL_SIZE]"},
+		{name: "invalid timeout", env: map[string]string{"NEO4J_CONNECTION_ACQUISITION_TIMEOUT": "5"}, err: "ParseDuration [NEO4J_CONNECTION_ACQUISITION_TIMEOUT]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range neo4jEnv {
+				t.Setenv(name, "")
+				os.Unsetenv(name)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := Neo4jConfigFromEnv()
+			if tt.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.err)
+				}
+				return
+			}
+
+			want := DefaultNeo4jConfig()
+			tt.want(want)
+			if assert.NoError(t, err) {
+				assert.Equal(t, want, cfg)
+			}
+		})
+	}
+}
+
+func TestLoadNeo4jConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want func(cfg *Neo4jConfig)
+		err  string
+	}{
+		{name: "empty", want: func(cfg *Neo4jConfig) {}},
+		{
+			name: "yaml",
+			data: "uri: neo4j://db:7687\nencrypted: false\nconnection_acquisition_timeout: 5s\n",
+			want: func(cfg *Neo4jConfig) {
+				cfg.URI, cfg.Encrypted, cfg.ConnectionAcquisitionTimeout = "neo4j://db:7687", boolPtr(false), 5*time.Second
+			},
+		},
+		{
+			name: "json",
+			data: `{"username": "user", "max_connection_pool_size": 10}`,
+			want: func(cfg *Neo4jConfig) {
+				cfg.Username, cfg.MaxConnectionPoolSize = "user", 10
+			},
+		},
+		{name: "unknown field", data: "url: bolt://db:7687\n", err: "field url not found"},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "neo4j.yaml")
+			if err := ioutil.WriteFile(path, []byte(tt.data), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := LoadNeo4jConfig(path)
+			if tt.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.err)
+				}
+				return
+			}
+
+			want := DefaultNeo4jConfig()
+			tt.want(want)
+			if assert.NoError(t, err) {
+				assert.Equal(t, want, cfg)
+			}
+		})
+	}
+}
+
+func TestDriverURI(t *testing.T) {
+	tests := []struct {
+		uri       string
+		encrypted *bool
+		trust     string
+		want      string
+		wantTrust string
+		err       string
+	}{
+		{uri: "bolt://db:7687", want: "bolt://db:7687"},
+		{uri: "bolt://db:7687", encrypted: boolPtr(false), trust: TrustCA, want: "bolt://db:7687", wantTrust: TrustCA},
+		{uri: "bolt+routing://db:7687", want: "bolt+routing://db:7687"},
+		{uri: "neo4j://db:7687", want: "bolt+routing://db:7687"},
+		{uri: "bolt+s://db:7687", want: "bolt://db:7687", wantTrust: TrustSystem},
+		{uri: "bolt+ssc://db:7687", want: "bolt://db:7687", wantTrust: TrustAny},
+		{uri: "neo4j+s://db:7687", want: "bolt+routing://db:7687", wantTrust: TrustSystem},
+		{uri: "neo4j+ssc://db:7687", want: "bolt+routing://db:7687", wantTrust: TrustAny},
+		{uri: "neo4j+s://db:7687", encrypted: boolPtr(true), trust: TrustSystem, want: "bolt+routing://db:7687", wantTrust: TrustSystem},
+		{uri: "neo4j+s://db:7687", trust: TrustAny, err: `uri scheme "neo4j+s" conflicts with trust "any"`},
+		{uri: "bolt+s://db:7687", trust: TrustCA, err: `uri scheme "bolt+s" conflicts with trust "ca"`},
+		{uri: "bolt+ssc://db:7687", trust: TrustSystem, err: `uri scheme "bolt+ssc" conflicts with trust "system"`},
+		{uri: "bolt+ssc://db:7687", encrypted: boolPtr(false), err: `uri scheme "bolt+ssc" conflicts with encrypted false`},
+		{uri: "http://db:7474", err: `unsupported uri scheme "http"`},
+		{uri: "bolt+x://db:7687", err: `unsupported uri scheme "bolt+x"`},
+		{uri: "://db", err: "Parse"},
+	}
+
+	for _, tt := range tests {
+		cfg := Neo4jConfig{URI: tt.uri, Encrypted: tt.encrypted, Trust: tt.trust}
+		uri, err := cfg.driverURI()
+		if tt.err != "" {
+			if assert.Error(t, err, tt.uri) {
+				assert.Contains(t, err.Error(), tt.err, tt.uri)
+			}
+			continue
+		}
+
+		if assert.NoError(t, err, tt.uri) {
+			assert.Equal(t, tt.want, uri, tt.uri)
+			assert.Equal(t, tt.wantTrust, cfg.Trust, tt.uri)
+			if tt.wantTrust != "" && tt.trust == "" {
+				assert.Equal(t, boolPtr(true), cfg.Encrypted, tt.uri)
+			} else {
+				assert.Equal(t, tt.encrypted, cfg.Encrypted, tt.uri)
+			}
+		}
+	}
+}
+
+func writeCertificate(t *testing.T, path string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "neo4j"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{0}})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func TestTrustStrategy(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "ca.pem")
+	cert := writeCertificate(t, certFile)
+
+	emptyFile := filepath.Join(dir, "empty.pem")
+	if err := ioutil.WriteFile(emptyFile, []byte("no pem"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		trust  string
+		verify bool
+		file   string
+		want   neo4j.TrustStrategy
+		err    string
+	}{
+		{trust: "", want: neo4j.TrustAny(false)},
+		{trust: TrustAny, verify: true, want: neo4j.TrustAny(true)},
+		{trust: TrustSystem, want: neo4j.TrustSystem(false)},
+		{trust: TrustSystem, verify: true, want: neo4j.TrustSystem(true)},
+		{trust: TrustCA, verify: true, file: certFile, want: neo4j.TrustOnly(true, cert)},
+		{trust: TrustCA, file: filepath.Join(dir, "missing.pem"), err: "ReadFile [ca cert]"},
+		{trust: TrustCA, file: emptyFile, err: "no certificates in " + emptyFile},
+		{trust: "none", err: `invalid trust strategy "none"`},
+	}
+
+	for _, tt := range tests {
+		cfg := Neo4jConfig{Trust: tt.trust, VerifyHostname: tt.verify, CACertFile: tt.file}
+		trust, err := cfg.trustStrategy()
+		if tt.err != "" {
+			if assert.Error(t, err, tt.trust) {
+				assert.Contains(t, err.Error(), tt.err, tt.trust)
+			}
+			continue
+		}
+
+		if assert.NoError(t, err, tt.trust) {
+			assert.Equal(t, tt.want, trust, tt.trust)
+		}
+	}
+}
+
+func TestAuthToken(t *testing.T) {
+	tests := []struct {
+		cfg  Neo4jConfig
+		want neo4j.AuthToken
+		err  string
+	}{
+		{cfg: Neo4jConfig{Auth: AuthNone}, want: neo4j.NoAuth()},
+		{cfg: Neo4jConfig{Username: "user", Password: "secret"}, want: neo4j.BasicAuth("user", "secret", "")},
+		{cfg: Neo4jConfig{Auth: AuthBasic, Username: "user", Password: "secret", Realm: "realm"}, want: neo4j.BasicAuth("user", "secret", "realm")},
+		{cfg: Neo4jConfig{Auth: AuthBasic, Password: "secret"}, err: "Neo4j username undefined"},
+		{cfg: Neo4jConfig{Auth: AuthBasic, Username: "user"}, err: "Neo4j password undefined"},
+		{cfg: Neo4jConfig{Auth: AuthKerberos, Ticket: "ticket"}, want: neo4j.KerberosAuth("ticket")},
+		{cfg: Neo4jConfig{Auth: AuthKerberos}, err: "Neo4j kerberos ticket undefined"},
+		{cfg: Neo4jConfig{Auth: AuthBearer, Token: "token"}, want: neo4j.CustomAuth("bearer", "", "token", "", nil)},
+		{cfg: Neo4jConfig{Auth: AuthBearer}, err: "Neo4j bearer token undefined"},
+		{cfg: Neo4jConfig{Auth: "ldap"}, err: `invalid auth type "ldap"`},
+	}
+
+	for _, tt := range tests {
+		token, err := tt.cfg.authToken()
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err, tt.cfg.Auth)
+			continue
+		}
+
+		if assert.NoError(t, err, tt.cfg.Auth) {
+			assert.Equal(t, tt.want, token, tt.cfg.Auth)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Package predicate builds shared.EvalFuncs on the properties of an EventContext
+// or HubContext, for use with the With selectors of event and hub chains:
+//
+//	event.OnNodeUpdated().And(
+//		event.With(predicate.FieldChangedFrom("status", "draft").To("published")),
+//		event.With(predicate.FieldGreaterThan("rank", 2)),
+//	)
+//
+// Numbers compare by value whether they were decoded as int64, float64 or json.Number.
+// Predicates never panic, a missing field or a value of another type does not match.
+package predicate
+
+import (
+	"reflect"
+	"regexp"
+
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	log logrus.FieldLogger = logrus.New().WithField("package", "predicate")
+)
+
+// properties returns the properties of the EventContext or HubContext arg.
+func properties(arg interface{}) shared.Properties {
+	switch ctx := arg.(type) {
+	case shared.EventContext:
+		return ctx.Properties
+	case *shared.EventContext:
+		if ctx != nil {
+			return ctx.Properties
+		}
+	case shared.HubContext:
+		return ctx.Properties
+	case *shared.HubContext:
+		if ctx != nil {
+			return ctx.Properties
+		}
+	}
+	return nil
+}
+
+// changes returns the ChangeInfos of the EventContext arg, HubContexts carry none.
+func changes(arg interface{}) shared.ChangeInfos {
+	switch ctx := arg.(type) {
+	case shared.EventContext:
+		return ctx.ChangeInfos
+	case *shared.EventContext:
+		if ctx != nil {
+			return ctx.ChangeInfos
+		}
+	}
+	return nil
+}
+
+func field(arg interface{}, name string) (interface{}, bool) {
+	val, ok := properties(arg)[name]
+	return val, ok
+}
+
+// compare orders two numbers, integers are compared without the precision loss of float64.
+func compare(a, b interface{}) (int, bool) {
+	if ia, ok := shared.AsInt64(a); ok {
+		if ib, ok := shared.AsInt64(b); ok {
+			switch {
+			case ia < ib:
+				return -1, true
+			case ia > ib:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+
+	fa, ok := shared.AsFloat64(a)
+	if !ok {
+		return 0, false
+	}
+	fb, ok := shared.AsFloat64(b)
+	if !ok {
+		return 0, false
+	}
+
+	switch {
+	case fa < fb:
+		return -1, true
+	case fa > fb:
+		return 1, true
+	}
+	return 0, true
+}
+
+// Equal reports whether a and b are equal, numbers are compared by value.
+func Equal(a, b interface{}) bool {
+	if res, ok := compare(a, b); ok {
+		return res == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// FieldEquals matches if field equals value.
+func FieldEquals(name string, value interface{}) shared.EvalFunc {
+	return func(arg interface{}) bool {
+		val, ok := field(arg, name)
+		return ok && Equal(val, value)
+	}
+}
+
+// FieldIn matches if field equals one of values.
+func FieldIn(name string, values ...interface{}) shared.EvalFunc {
+	return func(arg interface{}) bool {
+		val, ok := field(arg, name)
+		if !ok {
+			return false
+		}
+		for _, value := range values {
+			if Equal(val, value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FieldMatches matches if field is a string matching pattern.
+// An invalid pattern is logged and never matches.
+func FieldMatches(name, pattern string) shared.EvalFunc {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		log.Error(errors.Annotatef(err, "FieldMatches [%s]", name))
+		return func(arg interface{}) bool {
+			return false
+		}
+	}
+	return FieldMatchesRegexp(name, re)
+}
+
+// FieldMatchesRegexp matches if field is a string matching re.
+func FieldMatchesRegexp(name string, re *regexp.Regexp) shared.EvalFunc {
+	return func(arg interface{}) bool {
+		val, ok := field(arg, name)
+		if !ok {
+			return false
+		}
+		s, ok := val.(string)
+		return ok && re.MatchString(s)
+	}
+}
+
+func fieldCompare(name string, value interface{}, accept func(res int) bool) shared.EvalFunc {
+	return func(arg interface{}) bool {
+		val, ok := field(arg, name)
+		if !ok {
+			return false
+		}
+		res, ok := compare(val, value)
+		return ok && accept(res)
+	}
+}
+
+// FieldGreaterThan matches if field is a number greater than value.
+func FieldGreaterThan(name string, value interface{}) shared.EvalFunc {
+	return fieldCompare(name, value, func(res int) bool { return res > 0 })
+}
+
+// FieldGreaterOrEqual matches if field is a number greater than or equal to value.
+func FieldGreaterOrEqual(name string, value interface{}) shared.EvalFunc {
+	return fieldCompare(name, value, func(res int) bool { return res >= 0 })
+}
+
+// FieldLessThan matches if field is a number less than value.
+func FieldLessThan(name string, value interface{}) shared.EvalFunc {
+	return fieldCompare(name, value, func(res int) bool { return res < 0 })
+}
+
+// FieldLessOrEqual matches if field is a number less than or equal to value.
+func FieldLessOrEqual(name string, value interface{}) shared.EvalFunc {
+	return fieldCompare(name, value, func(res int) bool { return res <= 0 })
+}
+
+// FieldExists matches if field is set, even to null.
+func FieldExists(name string) shared.EvalFunc {
+	return func(arg interface{}) bool {
+		_, ok := field(arg, name)
+		return ok
+	}
+}
+
+// FieldIsNull matches if field is missing or set to null.
+func FieldIsNull(name string) shared.EvalFunc {
+	return func(arg interface{}) bool {
+		val, _ := field(arg, name)
+		return val == nil
+	}
+}
+
+// Transition matches a change of a field of an EventContext, see FieldChangedFrom.
+type Transition struct {
+	name string
+	from interface{}
+}
+
+// FieldChangedFrom starts a Transition of field away from value.
+func FieldChangedFrom(name string, value interface{}) Transition {
+	return Transition{name: name, from: value}
+}
+
+// To matches if the field changed from the value of the Transition to value.
+func (p Transition) To(value interface{}) shared.EvalFunc {
+	return func(arg interface{}) bool {
+		info, ok := changes(arg)[p.name]
+		return ok && !Equal(info.Before, info.After) &&
+			Equal(info.Before, p.from) && Equal(info.After, value)
+	}
+}
+
+// ToAny matches if the field changed from the value of the Transition to any other value.
+func (p Transition) ToAny() shared.EvalFunc {
+	return func(arg interface{}) bool {
+		info, ok := changes(arg)[p.name]
+		return ok && Equal(info.Before, p.from) && !Equal(info.After, p.from)
+	}
+}
+
+// Not inverts fn.
+func Not(fn shared.EvalFunc) shared.EvalFunc {
+	return func(arg interface{}) bool {
+		return !fn(arg)
+	}
+}
+
+// AllOf matches if all fns match.
+func AllOf(fns ...shared.EvalFunc) shared.EvalFunc {
+	return func(arg interface{}) bool {
+		for _, fn := range fns {
+			if !fn(arg) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// AnyOf matches if any of fns matches.
+func AnyOf(fns ...shared.EvalFunc) shared.EvalFunc {
+	return func(arg interface{}) bool {
+		for _, fn := range fns {
+			if fn(arg) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,78 @@
+package predicate
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/denkhaus/nksh/shared"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldPredicates(t *testing.T) {
+	var hubCtx shared.HubContext
+	err := json.Unmarshal([]byte(`{
+		"sender": "Photo",
+		"properties": {
+			"name": "denkhaus",
+			"rank": 2,
+			"score": 2.5,
+			"visible": false,
+			"deleted": null,
+			"tags": ["a", "b"]
+		}
+	}`), &hubCtx)
+	assert.NoError(t, err, "decode hub context")
+
+	evtCtx := shared.EventContext{
+		Properties: shared.Properties{
+			"rank": int64(2),
+			"tags": []interface{}{"a", "b"},
+		},
+	}
+
+	for _, ctx := range []interface{}{hubCtx, &hubCtx, evtCtx, &evtCtx} {
+		assert.True(t, FieldEquals("rank", 2)(ctx), "int equals %T", ctx)
+		assert.True(t, FieldEquals("rank", 2.0)(ctx), "float equals %T", ctx)
+		assert.False(t, FieldEquals("rank", "2")(ctx), "string equals %T", ctx)
+		assert.True(t, FieldEquals("tags", []interface{}{"a", "b"})(ctx), "slice equals %T", ctx)
+		assert.True(t, FieldIn("rank", 1, 2, 3)(ctx), "in %T", ctx)
+		assert.True(t, FieldGreaterThan("rank", 1)(ctx), "greater %T", ctx)
+		assert.True(t, FieldLessOrEqual("rank", int64(2))(ctx), "less or equal %T", ctx)
+		assert.False(t, FieldLessThan("rank", 1.5)(ctx), "less %T", ctx)
+		assert.False(t, FieldGreaterThan("tags", 1)(ctx), "greater non number %T", ctx)
+		assert.False(t, FieldEquals("missing", nil)(ctx), "missing equals %T", ctx)
+		assert.True(t, FieldIsNull("missing")(ctx), "missing is null %T", ctx)
+		assert.False(t, FieldExists("missing")(ctx), "missing exists %T", ctx)
+	}
+
+	assert.True(t, FieldMatches("name", "^denk")(hubCtx), "matches")
+	assert.False(t, FieldMatches("rank", "2")(hubCtx), "matches non string")
+	assert.False(t, FieldMatches("name", "(denk")(hubCtx), "invalid pattern")
+	assert.True(t, FieldExists("deleted")(hubCtx), "null exists")
+	assert.True(t, FieldIsNull("deleted")(hubCtx), "null is null")
+	assert.True(t, FieldGreaterOrEqual("score", 2.5)(hubCtx), "greater or equal")
+	assert.True(t, AllOf(FieldEquals("visible", false), Not(FieldIn("sender", "Photo")))(hubCtx), "all of")
+	assert.True(t, AnyOf(FieldEquals("visible", true), FieldExists("name"))(hubCtx), "any of")
+
+	assert.False(t, FieldEquals("rank", 2)(nil), "nil arg")
+	assert.False(t, FieldEquals("rank", 2)((*shared.HubContext)(nil)), "nil context")
+	assert.False(t, FieldEquals("rank", 2)("no context"), "foreign arg")
+}
+
+func TestFieldChangedFrom(t *testing.T) {
+	ctx := shared.EventContext{
+		ChangeInfos: shared.ChangeInfos{
+			"status": shared.ChangeInfo{Before: "draft", After: "published"},
+			"rank":   shared.ChangeInfo{Before: float64(1), After: int64(2)},
+			"geo":    shared.ChangeInfo{Before: []interface{}{1.0}, After: []interface{}{1.0}},
+		},
+	}
+
+	assert.True(t, FieldChangedFrom("status", "draft").To("published")(ctx), "changed")
+	assert.False(t, FieldChangedFrom("status", "draft").To("archived")(ctx), "changed elsewhere")
+	assert.True(t, FieldChangedFrom("status", "draft").ToAny()(ctx), "changed to any")
+	assert.True(t, FieldChangedFrom("rank", 1).To(2)(ctx), "changed numbers")
+	assert.False(t, FieldChangedFrom("geo", []interface{}{1.0}).ToAny()(ctx), "unchanged slice")
+	assert.False(t, FieldChangedFrom("missing", nil).ToAny()(ctx), "missing")
+	assert.False(t, FieldChangedFrom("status", "draft").To("published")(shared.HubContext{}), "hub context")
+}
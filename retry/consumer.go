@@ -0,0 +1,303 @@
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+)
+
+type targets map[goka.Stream]bool
+
+func newTargets(streams ...goka.Stream) targets {
+	t := make(targets)
+	for _, stream := range streams {
+		t[stream] = true
+	}
+	return t
+}
+
+func decodeFailedMessage(msg interface{}, t targets) (*shared.FailedMessage, error) {
+	m, ok := msg.(*shared.FailedMessage)
+	if !ok {
+		return nil, errors.Errorf("invalid message type %+v", msg)
+	}
+
+	if !t[m.Stream] {
+		return nil, errors.Errorf("invalid target stream %q", m.Stream)
+	}
+
+	return m, nil
+}
+
+// message is sent through the loop stream. It either delays a failed
+// message or polls the delayed messages.
+type message struct {
+	Failed *shared.FailedMessage `json:"failed,omitempty"`
+	Poll   bool                  `json:"poll,omitempty"`
+}
+
+type messageCodec struct{}
+
+func (p *messageCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (p *messageCodec) Decode(data []byte) (interface{}, error) {
+	var m message
+	return &m, json.Unmarshal(data, &m)
+}
+
+// delayed are the failed messages waiting for their RetryAt time in the group table.
+type delayed []*shared.FailedMessage
+
+type delayedCodec struct{}
+
+func (p *delayedCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (p *delayedCodec) Decode(data []byte) (interface{}, error) {
+	var d delayed
+	return d, json.Unmarshal(data, &d)
+}
+
+// deadline returns the earliest RetryAt time of msgs.
+func (p delayed) deadline() time.Time {
+	deadline := time.Time{}
+	for _, failed := range p {
+		if deadline.IsZero() || failed.RetryAt.Before(deadline) {
+			deadline = failed.RetryAt
+		}
+	}
+	return deadline
+}
+
+// delayedDeadline returns the deadline of encoded delayed messages.
+func delayedDeadline(value []byte) (time.Time, error) {
+	msgs, err := new(delayedCodec).Decode(value)
+	if err != nil {
+		return time.Time{}, errors.Annotate(err, "Decode")
+	}
+	return msgs.(delayed).deadline(), nil
+}
+
+func handleRetryEvents(ctx goka.Context, msg interface{}, t targets) error {
+	m, err := decodeFailedMessage(msg, t)
+	if err != nil {
+		return errors.Annotate(err, "decodeFailedMessage")
+	}
+
+	ctx.Loopback(m.Key, &message{Failed: m})
+	return nil
+}
+
+// handleDelayed adds a failed message to the delayed messages of its key and
+// emits the payload of all messages of the key due at now to their stream.
+func handleDelayed(ctx goka.Context, msg interface{}, now time.Time, d *shared.Deadlines) error {
+	m, ok := msg.(*message)
+	if !ok {
+		return errors.Errorf("invalid message type %+v", msg)
+	}
+
+	var msgs delayed
+	if val := ctx.Value(); val != nil {
+		msgs = val.(delayed)
+	}
+	if m.Failed != nil {
+		msgs = append(msgs, m.Failed)
+	}
+
+	pending := delayed{}
+	for _, failed := range msgs {
+		if failed.RetryAt.After(now) {
+			pending = append(pending, failed)
+			continue
+		}
+
+		log.Infof("retry msg %s to %s, chain %s, attempt %d", failed.Key, failed.Stream, failed.Chain, failed.Attempt)
+		ctx.Emit(failed.Stream, failed.Key, []byte(failed.Payload))
+	}
+
+	switch {
+	case len(pending) == len(msgs) && m.Failed == nil:
+		// nothing is due
+	case len(pending) == 0:
+		ctx.Delete()
+	default:
+		ctx.SetValue(pending)
+	}
+
+	d.Set(ctx.Key(), pending.deadline())
+	return nil
+}
+
+// handleDeadLetters emits the payload of a dead letter to its stream unless it failed
+// more than maxAttempts times, so a message failing again and again is replayed once
+// its attempts are exhausted and dropped the next time it arrives.
+func handleDeadLetters(ctx goka.Context, msg interface{}, t targets, maxAttempts int) error {
+	m, err := decodeFailedMessage(msg, t)
+	if err != nil {
+		return errors.Annotate(err, "decodeFailedMessage")
+	}
+
+	if m.Attempt > maxAttempts {
+		log.Warningf("drop msg %s [%s], chain %s failed %d times", m.Key, m.State, m.Chain, m.Attempt)
+		return nil
+	}
+
+	log.Infof("replay msg %s [%s] to %s, chain %s, attempt %d", m.Key, m.State, m.Stream, m.Chain, m.Attempt)
+	ctx.Emit(m.Stream, m.Key, []byte(m.Payload))
+	return nil
+}
+
+// receives failed messages, sends them back to the input streams of descr after their backoff
+func CreateConsumerDefaults(descr shared.EntityDescriptor) shared.DispatcherFunc {
+	return CreateConsumer(
+		descr.RetryGroup(),
+		descr.RetryStream(),
+		descr.EventInputStream(),
+		descr.HubInputStream(),
+	)
+}
+
+// CreateConsumer delays each FailedMessage in retryStream until its RetryAt time and
+// emits its payload to the originating stream, which must be one of targets. Delayed
+// messages are kept in the group table under the key of the failed message, a poll every
+// PollInterval emits them once due. On shutdown they stay there until the consumer is
+// started again.
+func CreateConsumer(group goka.Group, retryStream goka.Stream, targets ...goka.Stream) shared.DispatcherFunc {
+	return func(ctx context.Context, kServers, zServers []string) func() error {
+		health := shared.RegisterProcessor(ctx, group)
+		return func() error {
+			t := newTargets(targets...)
+			d := shared.NewDeadlines(delayedDeadline)
+			edges := []goka.Edge{
+				goka.Input(retryStream, new(shared.FailedMessageCodec), func(ctx goka.Context, msg interface{}) {
+					if err := handleRetryEvents(ctx, msg, t); err != nil {
+						log.Error(errors.Annotatef(err, "handleRetryEvents [%s]", retryStream))
+					}
+				}),
+				goka.Loop(new(messageCodec), func(ctx goka.Context, msg interface{}) {
+					if err := handleDelayed(ctx, msg, time.Now(), d); err != nil {
+						log.Error(errors.Annotate(err, "handleDelayed"))
+					}
+				}),
+				goka.Persist(new(delayedCodec)),
+			}
+
+			for stream := range t {
+				edges = append(edges, goka.Output(stream, new(codec.Bytes)))
+			}
+
+			g := goka.DefineGroup(group, edges...)
+			tmb := shared.TopicManagerBuilder(ctx, zServers)
+			emitter, err := goka.NewEmitter(kServers,
+				goka.Stream(g.LoopStream().Topic()), new(messageCodec),
+				shared.EmitterOptions(ctx,
+					goka.WithEmitterTopicManagerBuilder(tmb),
+				)...,
+			)
+			if err != nil {
+				return errors.Annotate(err, "NewEmitter")
+			}
+
+			pollCtx, cancel := context.WithCancel(ctx)
+			polled := make(chan struct{})
+			go func() {
+				defer close(polled)
+				d.Poll(pollCtx, PollInterval, func(key string) error {
+					_, err := emitter.Emit(key, &message{Poll: true})
+					return err
+				})
+			}()
+			defer func() {
+				cancel()
+				<-polled
+				if err := emitter.Finish(); err != nil {
+					log.Error(errors.Annotate(err, "Finish"))
+				}
+			}()
+
+			p, err := goka.NewProcessor(kServers, g,
+				shared.ProcessorOptions(ctx,
+					append(d.Options(),
+						goka.WithTopicManagerBuilder(tmb),
+					)...,
+				)...,
+			)
+			if err != nil {
+				return errors.Annotate(err, "NewProcessor")
+			}
+
+			if err := shared.RunProcessor(ctx, health, p); err != nil {
+				return errors.Annotate(err, "RunProcessor")
+			}
+
+			return nil
+		}
+	}
+}
+
+// receives dead letters, sends them back to the input streams of descr
+func CreateReplayerDefaults(descr shared.EntityDescriptor) shared.DispatcherFunc {
+	policy := descr.RetryPolicy()
+	if policy == nil {
+		policy = shared.DefaultRetryPolicy()
+	}
+
+	return CreateReplayer(
+		goka.Group(descr.Label()+"_Replay"),
+		policy.MaxAttempts,
+		descr.DeadLetterStream(),
+		descr.EventInputStream(),
+		descr.HubInputStream(),
+	)
+}
+
+// CreateReplayer emits the payload of each FailedMessage in deadLetterStream to the originating
+// stream, which must be one of targets. Being a consumer group, every dead letter is replayed
+// once, including those arriving while it runs. The payload keeps its attempt counter, dead
+// letters that failed more than maxAttempts times are dropped, so a replayed message failing
+// again does not loop between the replayer and the dead letter stream.
+func CreateReplayer(group goka.Group, maxAttempts int, deadLetterStream goka.Stream, targets ...goka.Stream) shared.DispatcherFunc {
+	return func(ctx context.Context, kServers, zServers []string) func() error {
+		health := shared.RegisterProcessor(ctx, group)
+		return func() error {
+			t := newTargets(targets...)
+			edges := []goka.Edge{
+				goka.Input(deadLetterStream, new(shared.FailedMessageCodec), func(ctx goka.Context, msg interface{}) {
+					if err := handleDeadLetters(ctx, msg, t, maxAttempts); err != nil {
+						log.Error(errors.Annotatef(err, "handleDeadLetters [%s]", deadLetterStream))
+					}
+				}),
+			}
+
+			for stream := range t {
+				edges = append(edges, goka.Output(stream, new(codec.Bytes)))
+			}
+
+			g := goka.DefineGroup(group, edges...)
+			p, err := goka.NewProcessor(kServers, g,
+				shared.ProcessorOptions(ctx,
+					goka.WithTopicManagerBuilder(
+						shared.TopicManagerBuilder(ctx, zServers),
+					),
+				)...,
+			)
+			if err != nil {
+				return errors.Annotate(err, "NewProcessor")
+			}
+
+			if err := shared.RunProcessor(ctx, health, p); err != nil {
+				return errors.Annotate(err, "RunProcessor")
+			}
+
+			return nil
+		}
+	}
+}
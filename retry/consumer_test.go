@@ -0,0 +1,84 @@
+package retry
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/denkhaus/nksh/graphtest"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/lovoo/goka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelay(t *testing.T) {
+	now := time.Now()
+	input := goka.Stream("Input2Person")
+	failed := func(key string, retryAt time.Time) *shared.FailedMessage {
+		return &shared.FailedMessage{
+			Stream:  input,
+			Key:     key,
+			Chain:   "rename",
+			Payload: json.RawMessage(`{"node_id":1004,"attempt":1,"chain":"rename"}`),
+			Attempt: 1,
+			RetryAt: retryAt,
+		}
+	}
+
+	ctx := graphtest.NewContext("Person_Retry", "Person-1004")
+	assert.NoError(t, handleRetryEvents(ctx, failed("Person-1004", now.Add(time.Second)), newTargets(input)))
+	assert.Empty(t, ctx.Emits, "not emitted before RetryAt")
+	if assert.Len(t, ctx.Loops, 1) {
+		assert.Equal(t, "Person-1004", ctx.Loops[0].Key, "delayed by message key")
+	}
+
+	err := handleRetryEvents(ctx, failed("Person-1004", now), newTargets("Input2Photo"))
+	assert.EqualError(t, err, `decodeFailedMessage: invalid target stream "Input2Person"`)
+
+	d := shared.NewDeadlines(delayedDeadline)
+	table := graphtest.NewContext(goka.Stream("Person_Retry-loop"), "Person-1004")
+	assert.NoError(t, handleDelayed(table, ctx.Loops[0].Value, now, d))
+	assert.NoError(t, handleDelayed(table, &message{Failed: failed("Person-1004", now.Add(-time.Second))}, now, d))
+	if assert.Len(t, table.Emits, 1, "due messages") {
+		assert.Equal(t, graphtest.Emitted{Stream: input, Key: "Person-1004", Value: []byte(failed("", now).Payload)}, table.Emits[0])
+	}
+	assert.Len(t, table.Value(), 1, "delayed messages")
+
+	value, err := new(delayedCodec).Encode(table.Value())
+	assert.NoError(t, err)
+	deadline, err := delayedDeadline(value)
+	assert.NoError(t, err)
+	assert.True(t, deadline.Equal(now.Add(time.Second)), "stored deadline")
+
+	assert.Empty(t, d.Due(now), "nothing due")
+	assert.Equal(t, []string{"Person-1004"}, d.Due(now.Add(time.Second)), "due keys")
+	assert.NoError(t, handleDelayed(table, &message{Poll: true}, now.Add(time.Second), d))
+	assert.Len(t, table.Emits, 2, "due messages")
+	assert.Nil(t, table.Value(), "deleted")
+	assert.Empty(t, d.Due(now.Add(time.Hour)), "no delayed messages")
+}
+
+func TestReplay(t *testing.T) {
+	dead := &shared.FailedMessage{
+		Stream:  "Input2Person",
+		Key:     "Person-1004",
+		Chain:   "rename",
+		Payload: json.RawMessage(`{"node_id":1004,"attempt":2,"chain":"rename"}`),
+		Attempt: 2,
+	}
+
+	ctx := graphtest.NewContext("Person_DeadLetter", "Person-1004")
+	err := handleDeadLetters(ctx, dead, newTargets("Input2Person"), 2)
+	assert.NoError(t, err, "replay dead letter")
+	assert.Len(t, ctx.Emits, 1, "replayed messages")
+
+	var replayed shared.EventContext
+	assert.NoError(t, json.Unmarshal(ctx.Emits[0].Value.([]byte), &replayed), "decode payload")
+	assert.Equal(t, int64(1004), replayed.NodeID, "replayed node id")
+	assert.Equal(t, 2, replayed.Attempt, "replayed attempt")
+	assert.Equal(t, "rename", replayed.Chain, "replayed chain")
+
+	dead.Attempt = 3
+	assert.NoError(t, handleDeadLetters(ctx, dead, newTargets("Input2Person"), 2), "drop dead letter")
+	assert.Len(t, ctx.Emits, 1, "exhausted dead letters are dropped")
+}
@@ -0,0 +1,14 @@
+package retry
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	log logrus.FieldLogger = logrus.New().WithField("package", "retry")
+
+	// PollInterval is the interval the retry consumer emits due messages in.
+	PollInterval = time.Second
+)
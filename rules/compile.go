@@ -0,0 +1,492 @@
+package rules
+
+import (
+	"fmt"
+
+	"github.com/denkhaus/nksh/event"
+	"github.com/denkhaus/nksh/expr"
+	"github.com/denkhaus/nksh/hub"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	yaml "gopkg.in/yaml.v3"
+)
+
+var (
+	KindEvent = "event"
+	KindHub   = "hub"
+)
+
+type eventSelector func(p *compiler, n *yaml.Node) event.Combinable
+type hubSelector func(p *compiler, n *yaml.Node) hub.Combinable
+
+var eventSelectors = map[string]eventSelector{
+	"onNodeCreated": func(p *compiler, n *yaml.Node) event.Combinable {
+		p.flag(n)
+		return event.OnNodeCreated()
+	},
+	"onNodeUpdated": func(p *compiler, n *yaml.Node) event.Combinable {
+		p.flag(n)
+		return event.OnNodeUpdated()
+	},
+	"onNodeDeleted": func(p *compiler, n *yaml.Node) event.Combinable {
+		p.flag(n)
+		return event.OnNodeDeleted()
+	},
+	"onFieldCreated": func(p *compiler, n *yaml.Node) event.Combinable {
+		return event.OnFieldCreated(p.scalar(n))
+	},
+	"onFieldUpdated": func(p *compiler, n *yaml.Node) event.Combinable {
+		return event.OnFieldUpdated(p.scalar(n))
+	},
+	"onFieldDeleted": func(p *compiler, n *yaml.Node) event.Combinable {
+		return event.OnFieldDeleted(p.scalar(n))
+	},
+	"onLabelAdded": func(p *compiler, n *yaml.Node) event.Combinable {
+		return event.OnLabelAdded(p.scalar(n))
+	},
+	"onLabelRemoved": func(p *compiler, n *yaml.Node) event.Combinable {
+		return event.OnLabelRemoved(p.scalar(n))
+	},
+	"onRelationshipCreated": func(p *compiler, n *yaml.Node) event.Combinable {
+		return event.OnRelationshipCreated(p.scalar(n))
+	},
+	"onRelationshipUpdated": func(p *compiler, n *yaml.Node) event.Combinable {
+		return event.OnRelationshipUpdated(p.scalar(n))
+	},
+	"onRelationshipDeleted": func(p *compiler, n *yaml.Node) event.Combinable {
+		return event.OnRelationshipDeleted(p.scalar(n))
+	},
+	"onRelationshipFieldCreated": func(p *compiler, n *yaml.Node) event.Combinable {
+		return event.OnRelationshipFieldCreated(p.relationshipField(n))
+	},
+	"onRelationshipFieldUpdated": func(p *compiler, n *yaml.Node) event.Combinable {
+		return event.OnRelationshipFieldUpdated(p.relationshipField(n))
+	},
+	"onRelationshipFieldDeleted": func(p *compiler, n *yaml.Node) event.Combinable {
+		return event.OnRelationshipFieldDeleted(p.relationshipField(n))
+	},
+}
+
+var hubSelectors = map[string]hubSelector{
+	"from": func(p *compiler, n *yaml.Node) hub.Combinable {
+		return hub.From(p.scalar(n))
+	},
+	"onNodeCreated": func(p *compiler, n *yaml.Node) hub.Combinable {
+		p.flag(n)
+		return hub.OnNodeCreated()
+	},
+	"onNodeUpdated": func(p *compiler, n *yaml.Node) hub.Combinable {
+		p.flag(n)
+		return hub.OnNodeUpdated()
+	},
+	"onNodeDeleted": func(p *compiler, n *yaml.Node) hub.Combinable {
+		p.flag(n)
+		return hub.OnNodeDeleted()
+	},
+}
+
+var (
+	ruleKeys      = []string{"name", "label", "on", "if", "then", "else", "catch", "transactional"}
+	conditionKeys = []string{"with", "where", "expr", "and", "or", "not"}
+)
+
+// compiler walks the nodes of a rule document and collects
+// every problem instead of stopping at the first one.
+type compiler struct {
+	registry *Registry
+	names    map[string]int
+	errs     Errors
+}
+
+func (p *compiler) errorf(n *yaml.Node, format string, args ...interface{}) {
+	p.errs = append(p.errs, Error{
+		Line:    n.Line,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// mapping returns the values of n by key and reports unknown or duplicate keys.
+func (p *compiler) mapping(n *yaml.Node, keys []string) (map[string]*yaml.Node, bool) {
+	if n.Kind != yaml.MappingNode {
+		p.errorf(n, "expected a mapping")
+		return nil, false
+	}
+
+	known := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		known[key] = true
+	}
+
+	res := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+		switch {
+		case !known[key.Value]:
+			p.errorf(key, "unknown key %q", key.Value)
+		case res[key.Value] != nil:
+			p.errorf(key, "duplicate key %q", key.Value)
+		default:
+			res[key.Value] = val
+		}
+	}
+
+	return res, true
+}
+
+// sequence returns the items of n, a single item is taken as a sequence of one.
+func (p *compiler) sequence(n *yaml.Node) []*yaml.Node {
+	if n == nil {
+		return nil
+	}
+	if n.Kind == yaml.SequenceNode {
+		return n.Content
+	}
+	return []*yaml.Node{n}
+}
+
+func (p *compiler) scalar(n *yaml.Node) string {
+	if n.Kind != yaml.ScalarNode || n.Tag == "!!null" || n.Value == "" {
+		p.errorf(n, "expected a non-empty string")
+		return ""
+	}
+	return n.Value
+}
+
+func (p *compiler) boolean(n *yaml.Node) bool {
+	if n == nil {
+		return false
+	}
+
+	var res bool
+	if n.Kind != yaml.ScalarNode || n.Decode(&res) != nil {
+		p.errorf(n, "expected true or false")
+	}
+	return res
+}
+
+// flag validates the value of selectors without arguments, which is either empty or true.
+func (p *compiler) flag(n *yaml.Node) {
+	if n.Kind == yaml.ScalarNode && (n.Tag == "!!null" || n.Tag == "!!bool" && n.Value == "true") {
+		return
+	}
+	p.errorf(n, "expected no value or true")
+}
+
+func (p *compiler) relationshipField(n *yaml.Node) (string, string) {
+	m, ok := p.mapping(n, []string{"type", "field"})
+	if !ok {
+		return "", ""
+	}
+
+	var relType, field string
+	if p.require(n, m, "type") {
+		relType = p.scalar(m["type"])
+	}
+	if p.require(n, m, "field") {
+		field = p.scalar(m["field"])
+	}
+	return relType, field
+}
+
+func (p *compiler) require(n *yaml.Node, m map[string]*yaml.Node, key string) bool {
+	if _, ok := m[key]; !ok {
+		p.errorf(n, "missing key %q", key)
+		return false
+	}
+	return true
+}
+
+// selector returns the single key of n found in selectors, or nil if there is none.
+func (p *compiler) selector(n *yaml.Node, isSelector func(key string) bool) (*yaml.Node, *yaml.Node) {
+	var key, val *yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if !isSelector(n.Content[i].Value) {
+			continue
+		}
+		if key != nil {
+			p.errorf(n.Content[i], "selector %q conflicts with %q", n.Content[i].Value, key.Value)
+			continue
+		}
+		key, val = n.Content[i], n.Content[i+1]
+	}
+	return key, val
+}
+
+func (p *compiler) document(n *yaml.Node) *RuleSet {
+	set := RuleSet{}
+	if n.Kind != yaml.DocumentNode || len(n.Content) == 0 {
+		p.errs = append(p.errs, Error{Line: 1, Message: "empty rule document"})
+		return &set
+	}
+
+	doc, ok := p.mapping(n.Content[0], []string{"rules"})
+	if !ok || !p.require(n.Content[0], doc, "rules") {
+		return &set
+	}
+
+	if doc["rules"].Kind != yaml.SequenceNode {
+		p.errorf(doc["rules"], "expected a sequence of rules")
+		return &set
+	}
+
+	for _, r := range doc["rules"].Content {
+		p.rule(r, &set)
+	}
+
+	return &set
+}
+
+func (p *compiler) rule(n *yaml.Node, set *RuleSet) {
+	r, ok := p.mapping(n, ruleKeys)
+	if !ok {
+		return
+	}
+
+	errs := len(p.errs)
+	name := p.name(n, r)
+	then := p.handlers(r["then"])
+	if p.require(n, r, "then") && len(r["then"].Content) == 0 && r["then"].Kind == yaml.SequenceNode {
+		p.errorf(r["then"], "expected at least one handler")
+	}
+	els := p.handlers(r["else"])
+	catch := p.catch(name, r["catch"])
+	transactional := p.boolean(r["transactional"])
+	var label string
+	if r["label"] != nil {
+		label = p.scalar(r["label"])
+	}
+
+	if !p.require(n, r, "on") || !p.require(n, r, "if") {
+		return
+	}
+
+	switch kind := p.scalar(r["on"]); kind {
+	case KindEvent:
+		comb := p.eventCondition(r["if"])
+		if len(p.errs) > errs {
+			return
+		}
+
+		var exe event.Executable
+		if len(els) > 0 {
+			exe = event.If(comb).Then(then...).Else(els...).Catch(catch)
+		} else {
+			exe = event.If(comb).Then(then...).Catch(catch)
+		}
+		if transactional {
+			exe = exe.Transactional()
+		}
+		if label != "" {
+			exe = exe.Scoped(label)
+		}
+		set.Events = append(set.Events, exe.Named(name))
+	case KindHub:
+		comb := p.hubCondition(r["if"])
+		if len(p.errs) > errs {
+			return
+		}
+
+		var exe hub.Executable
+		if len(els) > 0 {
+			exe = hub.If(comb).Then(then...).Else(els...).Catch(catch)
+		} else {
+			exe = hub.If(comb).Then(then...).Catch(catch)
+		}
+		if transactional {
+			exe = exe.Transactional()
+		}
+		if label != "" {
+			exe = exe.Scoped(label)
+		}
+		set.Hubs = append(set.Hubs, exe.Named(name))
+	case "":
+	default:
+		p.errorf(r["on"], "unknown kind %q, expected %s or %s", kind, KindEvent, KindHub)
+	}
+}
+
+func (p *compiler) name(n *yaml.Node, r map[string]*yaml.Node) string {
+	if !p.require(n, r, "name") {
+		return ""
+	}
+
+	name := p.scalar(r["name"])
+	if name == "" {
+		return ""
+	}
+	if line, ok := p.names[name]; ok {
+		p.errorf(r["name"], "duplicate rule name %q, first defined at line %d", name, line)
+	}
+
+	p.names[name] = r["name"].Line
+	return name
+}
+
+func (p *compiler) handlers(n *yaml.Node) []shared.Handler {
+	res := []shared.Handler{}
+	for _, ref := range p.sequence(n) {
+		name := p.scalar(ref)
+		if name == "" {
+			continue
+		}
+		fn, ok := p.registry.handler(name)
+		if !ok {
+			p.errorf(ref, "unknown handler %q", name)
+			continue
+		}
+		res = append(res, fn)
+	}
+	return res
+}
+
+// catch returns the referenced error handler, rules without catch log their errors.
+func (p *compiler) catch(rule string, n *yaml.Node) shared.ErrorHandler {
+	if n == nil {
+		return func(err error) {
+			log.Error(errors.Annotatef(err, "rule %s", rule))
+		}
+	}
+
+	name := p.scalar(n)
+	if name == "" {
+		return nil
+	}
+	fn, ok := p.registry.errorHandler(name)
+	if !ok {
+		p.errorf(n, "unknown error handler %q", name)
+	}
+	return fn
+}
+
+// conditions returns the referenced with conditions followed by the where predicates and expressions,
+// they are conditions of the selector of m and bind tighter than its and, or and not branches.
+func (p *compiler) conditions(m map[string]*yaml.Node, env *expr.Env) shared.EvalFuncs {
+	res := shared.EvalFuncs{}
+	for _, ref := range p.sequence(m["with"]) {
+		name := p.scalar(ref)
+		if name == "" {
+			continue
+		}
+		fn, ok := p.registry.condition(name)
+		if !ok {
+			p.errorf(ref, "unknown condition %q", name)
+			continue
+		}
+		res = append(res, fn)
+	}
+
+	for _, pred := range p.sequence(m["where"]) {
+		if fn := p.predicate(pred); fn != nil {
+			res = append(res, fn)
+		}
+	}
+
+	for _, src := range p.sequence(m["expr"]) {
+		prog, err := expr.Compile(p.scalar(src), env)
+		if err != nil {
+			p.errorf(src, "invalid expression: %s", err)
+			continue
+		}
+		res = append(res, prog.Eval)
+	}
+
+	return res
+}
+
+func (p *compiler) eventCondition(n *yaml.Node) event.Combinable {
+	keys := append([]string{"ignoreOwnWrites"}, conditionKeys...)
+	for key := range eventSelectors {
+		keys = append(keys, key)
+	}
+
+	m, ok := p.mapping(n, keys)
+	if !ok {
+		return nil
+	}
+
+	var comb event.Combinable
+	if key, val := p.selector(n, func(key string) bool {
+		_, ok := eventSelectors[key]
+		return ok
+	}); key != nil {
+		comb = eventSelectors[key.Value](p, val)
+	}
+
+	conds := p.conditions(m, expr.EventEnv)
+	if comb == nil {
+		if len(conds) == 0 {
+			p.errorf(n, "expected a selector, with, where or expr")
+			return nil
+		}
+		comb, conds = event.With(conds[0]), conds[1:]
+	}
+	for _, cond := range conds {
+		comb = comb.With(cond)
+	}
+
+	comb = comb.And(p.eventConditions(m["and"])...)
+	comb = comb.Or(p.eventConditions(m["or"])...)
+	comb = comb.Not(p.eventConditions(m["not"])...)
+	if p.boolean(m["ignoreOwnWrites"]) {
+		comb = comb.IgnoreOwnWrites()
+	}
+
+	return comb
+}
+
+func (p *compiler) eventConditions(n *yaml.Node) []event.Combinable {
+	res := []event.Combinable{}
+	for _, item := range p.sequence(n) {
+		if comb := p.eventCondition(item); comb != nil {
+			res = append(res, comb)
+		}
+	}
+	return res
+}
+
+func (p *compiler) hubCondition(n *yaml.Node) hub.Combinable {
+	keys := append([]string{}, conditionKeys...)
+	for key := range hubSelectors {
+		keys = append(keys, key)
+	}
+
+	m, ok := p.mapping(n, keys)
+	if !ok {
+		return nil
+	}
+
+	var comb hub.Combinable
+	if key, val := p.selector(n, func(key string) bool {
+		_, ok := hubSelectors[key]
+		return ok
+	}); key != nil {
+		comb = hubSelectors[key.Value](p, val)
+	}
+
+	conds := p.conditions(m, expr.HubEnv)
+	if comb == nil {
+		if len(conds) == 0 {
+			p.errorf(n, "expected a selector, with, where or expr")
+			return nil
+		}
+		comb, conds = hub.With(conds[0]), conds[1:]
+	}
+	for _, cond := range conds {
+		comb = comb.With(cond)
+	}
+
+	comb = comb.And(p.hubConditions(m["and"])...)
+	comb = comb.Or(p.hubConditions(m["or"])...)
+	comb = comb.Not(p.hubConditions(m["not"])...)
+	return comb
+}
+
+func (p *compiler) hubConditions(n *yaml.Node) []hub.Combinable {
+	res := []hub.Combinable{}
+	for _, item := range p.sequence(n) {
+		if comb := p.hubCondition(item); comb != nil {
+			res = append(res, comb)
+		}
+	}
+	return res
+}
@@ -0,0 +1,171 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+)
+
+var (
+	DefaultWatchInterval = 5 * time.Second
+)
+
+// Holder keeps the RuleSet of running consumers. Every accepted rule set
+// is swapped into the ChainSet of the holder as its next version, a
+// rejected one leaves the current version in place.
+type Holder struct {
+	registry *Registry
+	chains   *shared.ChainSet
+	current  *RuleSet
+	previous *RuleSet
+	mu       sync.Mutex
+}
+
+// NewHolder holds set as version 1, set may be nil to start without rules.
+func NewHolder(reg *Registry, set *RuleSet) *Holder {
+	if set == nil {
+		set = &RuleSet{}
+	}
+
+	h := Holder{
+		registry: reg,
+		chains:   shared.NewChainSet(set.chains()...),
+		current:  set,
+	}
+	return &h
+}
+
+// Chains returns the event and hub chains of the rule set to run with
+// event.CreateChainSetConsumerDefaults and hub.CreateChainSetConsumerDefaults.
+// Rules with a label run only in the consumers of the descriptor with that label.
+func (p *Holder) Chains() *shared.ChainSet {
+	return p.chains
+}
+
+// Version returns the version of the current rule set.
+func (p *Holder) Version() int64 {
+	return p.chains.Version()
+}
+
+func (p *Holder) swap(set *RuleSet, reason string) int64 {
+	p.previous, p.current = p.current, set
+	version := p.chains.Store(set.chains()...)
+
+	log.Infof("rule set version %d (%s): %d event and %d hub chains",
+		version, reason, len(set.Events), len(set.Hubs))
+	return version
+}
+
+// Reload compiles data and swaps it in as the next version. An invalid
+// document is rejected and the current version is kept.
+func (p *Holder) Reload(data []byte) (int64, error) {
+	set, err := Parse(data, p.registry)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		version := p.Version()
+		log.Errorf("rule set rejected, keeping version %d: %s", version, err)
+		return version, errors.Annotate(err, "Parse")
+	}
+
+	return p.swap(set, "reload"), nil
+}
+
+// ReloadFile reloads the rule document at path, see Reload.
+func (p *Holder) ReloadFile(path string) (int64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return p.Version(), errors.Annotate(err, "ReadFile")
+	}
+
+	version, err := p.Reload(data)
+	if err != nil {
+		return version, errors.Annotate(err, path)
+	}
+
+	return version, nil
+}
+
+// Rollback swaps the rule set replaced by the last swap back in as the next version.
+func (p *Holder) Rollback() (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.previous == nil {
+		return p.Version(), errors.New("no previous rule set")
+	}
+
+	return p.swap(p.previous, "rollback"), nil
+}
+
+// Watch reloads the rule document at path whenever its content changed since Watch
+// started, until ctx is done. A rejected content is not retried until it changes again.
+func (p *Holder) Watch(ctx context.Context, path string, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	last, _ := ioutil.ReadFile(path)
+	check := func() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Error(errors.Annotate(err, "ReadFile"))
+			return
+		}
+		if bytes.Equal(data, last) {
+			return
+		}
+
+		last = data
+		if _, err := p.Reload(data); err != nil {
+			log.Error(errors.Annotate(err, path))
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+// ReloadHandler reloads the rule document posted to it
+// and reports the current version on GET.
+func (p *Holder) ReloadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprintf(w, "version %d\n", p.Version())
+		case http.MethodPost, http.MethodPut:
+			data, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintln(w, err)
+				return
+			}
+
+			version, err := p.Reload(data)
+			if err != nil {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprintf(w, "version %d\n%s\n", version, errors.Cause(err))
+				return
+			}
+
+			fmt.Fprintf(w, "version %d\n", version)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
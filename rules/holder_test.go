@@ -0,0 +1,97 @@
+package rules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/denkhaus/nksh/event"
+	"github.com/denkhaus/nksh/hub"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/stretchr/testify/assert"
+)
+
+var reloaded = `
+rules:
+  - name: created
+    on: event
+    if:
+      onNodeCreated:
+    then: count
+`
+
+// names returns the names of the event and of the hub chains of set.
+func names(set *shared.ChainSet) ([]string, []string) {
+	chains, _ := set.Load()
+	events, hubs := []string{}, []string{}
+	for _, chain := range chains {
+		switch exe := chain.(type) {
+		case event.Executable:
+			events = append(events, exe.Name())
+		case hub.Executable:
+			hubs = append(hubs, exe.Name())
+		}
+	}
+	return events, hubs
+}
+
+func TestHolder(t *testing.T) {
+	reg := newRegistry(t, new(int))
+	set, err := Parse([]byte(document), reg)
+	if !assert.NoError(t, err, "parse") {
+		return
+	}
+
+	h := NewHolder(reg, set)
+	assert.Equal(t, int64(1), h.Version())
+	events, hubs := names(h.Chains())
+	assert.Equal(t, []string{"rename"}, events)
+	assert.Equal(t, []string{"hide"}, hubs)
+
+	version, err := h.Reload([]byte(reloaded))
+	assert.NoError(t, err, "reload")
+	assert.Equal(t, int64(2), version)
+	assert.Equal(t, version, h.Chains().Version(), "version of the chains")
+
+	events, hubs = names(h.Chains())
+	assert.Equal(t, []string{"created"}, events)
+	assert.Empty(t, hubs)
+
+	version, err = h.Reload([]byte("rules:\n  - name: broken\n"))
+	assert.Error(t, err, "invalid rule set")
+	assert.Equal(t, int64(2), version)
+
+	events, _ = names(h.Chains())
+	assert.Equal(t, []string{"created"}, events)
+
+	version, err = h.Rollback()
+	assert.NoError(t, err, "rollback")
+	assert.Equal(t, int64(3), version)
+	assert.Equal(t, int64(3), h.Version())
+
+	events, hubs = names(h.Chains())
+	assert.Equal(t, []string{"rename"}, events)
+	assert.Equal(t, []string{"hide"}, hubs)
+}
+
+func TestReloadHandler(t *testing.T) {
+	h := NewHolder(newRegistry(t, new(int)), nil)
+
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ReloadHandler().ServeHTTP(rec, httptest.NewRequest(method, "/", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := serve("POST", reloaded)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "version 2\n", rec.Body.String())
+
+	rec = serve("POST", "rules: {}")
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, "version 2\nline 1: expected a sequence of rules\n", rec.Body.String())
+
+	rec = serve("GET", "")
+	assert.Equal(t, "version 2\n", rec.Body.String())
+}
@@ -0,0 +1,180 @@
+// Package rules compiles declarative YAML or JSON rule documents into event
+// and hub chains. Handlers, conditions and error handlers are referenced by
+// the names they are registered with in a Registry. The keys and, or and not
+// combine a condition with the listed conditions like the chain methods of
+// the same name, where adds property predicates, expr expressions of package
+// expr and with registered conditions. where, expr and with belong to the
+// selector of their mapping and are matched together with it, before or, and
+// and not are applied in that order: a mapping with a selector S, or: [X],
+// and: [A] and where: W matches ((S && W) || X) && A. A rule with a label
+// runs only in the consumers of the descriptor with that label, others run
+// in every consumer.
+//
+//	rules:
+//	  - name: hide-photos
+//	    label: Photo
+//	    on: hub
+//	    if:
+//	      onNodeUpdated:
+//	      and:
+//	        - from: Person
+//	          or:
+//	            - from: Photo
+//	      where:
+//	        - field: visible
+//	          equals: false
+//	    then: [hideReceiver]
+//	    catch: logError
+package rules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/denkhaus/nksh/event"
+	"github.com/denkhaus/nksh/hub"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v3"
+)
+
+var (
+	log logrus.FieldLogger = logrus.New().WithField("package", "rules")
+)
+
+// Registry maps the names used in rule documents to Go functions.
+type Registry struct {
+	handlers      map[string]shared.Handler
+	conditions    map[string]shared.EvalFunc
+	errorHandlers map[string]shared.ErrorHandler
+	mu            sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	r := Registry{
+		handlers:      make(map[string]shared.Handler),
+		conditions:    make(map[string]shared.EvalFunc),
+		errorHandlers: make(map[string]shared.ErrorHandler),
+	}
+	return &r
+}
+
+// RegisterHandler makes fn available to the then and else lists of rules.
+func (p *Registry) RegisterHandler(name string, fn shared.Handler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handlers[name] = fn
+}
+
+// RegisterCondition makes fn available to the with lists of rules.
+func (p *Registry) RegisterCondition(name string, fn shared.EvalFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.conditions[name] = fn
+}
+
+// RegisterErrorHandler makes fn available to the catch of rules.
+func (p *Registry) RegisterErrorHandler(name string, fn shared.ErrorHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.errorHandlers[name] = fn
+}
+
+func (p *Registry) handler(name string) (shared.Handler, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	fn, ok := p.handlers[name]
+	return fn, ok
+}
+
+func (p *Registry) condition(name string) (shared.EvalFunc, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	fn, ok := p.conditions[name]
+	return fn, ok
+}
+
+func (p *Registry) errorHandler(name string) (shared.ErrorHandler, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	fn, ok := p.errorHandlers[name]
+	return fn, ok
+}
+
+// Error is a problem found at Line of a rule document.
+type Error struct {
+	Line    int
+	Message string
+}
+
+func (p Error) Error() string {
+	return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+}
+
+// Errors are all problems found in a rule document.
+type Errors []Error
+
+func (p Errors) Error() string {
+	msgs := make([]string, 0, len(p))
+	for _, err := range p {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// RuleSet holds the chains of a rule document in document order,
+// each named after its rule.
+type RuleSet struct {
+	Events []event.Executable
+	Hubs   []hub.Executable
+}
+
+func (p *RuleSet) chains() []interface{} {
+	chains := make([]interface{}, 0, len(p.Events)+len(p.Hubs))
+	for _, exe := range p.Events {
+		chains = append(chains, exe)
+	}
+	for _, exe := range p.Hubs {
+		chains = append(chains, exe)
+	}
+	return chains
+}
+
+// Parse compiles the YAML or JSON rule document data. A document with
+// any invalid rule is rejected as a whole with Errors.
+func Parse(data []byte, reg *Registry) (*RuleSet, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Annotate(err, "Unmarshal")
+	}
+
+	c := compiler{
+		registry: reg,
+		names:    make(map[string]int),
+	}
+
+	set := c.document(&doc)
+	if len(c.errs) > 0 {
+		return nil, c.errs
+	}
+
+	return set, nil
+}
+
+// ParseFile compiles the rule document at path, see Parse.
+func ParseFile(path string, reg *Registry) (*RuleSet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotate(err, "ReadFile")
+	}
+
+	set, err := Parse(data, reg)
+	if err != nil {
+		return nil, errors.Annotate(err, path)
+	}
+
+	return set, nil
+}
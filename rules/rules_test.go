@@ -0,0 +1,261 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/denkhaus/nksh/predicate"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var document = `
+rules:
+  - name: rename
+    on: event
+    if:
+      onNodeUpdated:
+      and:
+        - onFieldUpdated: first_name
+      expr: changes.first_name.before == "Anne"
+      not:
+        - where:
+            field: status
+            in: [deleted, archived]
+    then: [count]
+    catch: fail
+
+  - name: hide
+    on: hub
+    if:
+      onNodeUpdated: true
+      and:
+        - from: Person
+          or:
+            - from: Photo
+      where:
+        - field: visible
+          equals: false
+        - field: rank
+          equals: 2
+    then: count
+    else: [count, count]
+    catch: fail
+`
+
+func newRegistry(t *testing.T, handled *int) *Registry {
+	reg := NewRegistry()
+	reg.RegisterHandler("count", func(_ *shared.HandlerContext) error {
+		*handled++
+		return nil
+	})
+	reg.RegisterErrorHandler("fail", func(err error) {
+		assert.NoError(t, err, "handled error")
+	})
+	reg.RegisterCondition("visible", predicate.FieldEquals("visible", true))
+	return reg
+}
+
+func TestParse(t *testing.T) {
+	handled := 0
+	set, err := Parse([]byte(document), newRegistry(t, &handled))
+	if !assert.NoError(t, err, "parse") {
+		return
+	}
+
+	assert.Len(t, set.Events, 1)
+	assert.Len(t, set.Hubs, 1)
+
+	evt := &shared.EventContext{
+		Operation: shared.UpdatedOperation,
+		ChangeInfos: shared.ChangeInfos{
+			"first_name": shared.ChangeInfo{Before: "Anne", After: "Anne Marie"},
+		},
+		Properties: shared.Properties{"first_name": "Anne Marie", "status": "active"},
+	}
+
+	assert.Equal(t, "rename", set.Events[0].Name())
+	assert.Equal(t, shared.ChainHandledStateThen, set.Events[0].Execute(nil, evt))
+	assert.Equal(t, 1, handled)
+
+	evt.Properties["status"] = "archived"
+	assert.Equal(t, shared.ChainHandledStateUnhandled, set.Events[0].Execute(nil, evt))
+
+	// json numbers are float64
+	hubCtx := &shared.HubContext{
+		Sender:     "Photo",
+		Operation:  shared.UpdatedOperation,
+		Properties: shared.Properties{"visible": false, "rank": float64(2)},
+	}
+
+	handled = 0
+	assert.Equal(t, "hide", set.Hubs[0].Name())
+	assert.Equal(t, shared.ChainHandledStateThen, set.Hubs[0].Execute(nil, hubCtx))
+	assert.Equal(t, 1, handled)
+
+	hubCtx.Sender = "Tag"
+	assert.Equal(t, shared.ChainHandledStateElse, set.Hubs[0].Execute(nil, hubCtx))
+	assert.Equal(t, 3, handled)
+}
+
+func TestParseJSON(t *testing.T) {
+	handled := 0
+	set, err := Parse([]byte(`{
+	"rules": [{
+		"name": "visible",
+		"on": "hub",
+		"if": {"with": "visible", "not": [{"from": "Tag"}]},
+		"then": ["count"]
+	}]
+}`), newRegistry(t, &handled))
+	if !assert.NoError(t, err, "parse") {
+		return
+	}
+
+	hubCtx := &shared.HubContext{
+		Sender:     "Photo",
+		Properties: shared.Properties{"visible": true},
+	}
+
+	assert.Equal(t, shared.ChainHandledStateThen, set.Hubs[0].Execute(nil, hubCtx))
+	assert.Equal(t, 1, handled)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse([]byte(`
+rules:
+  - name: first
+    on: event
+    if:
+      onNodeUpdated:
+      onFieldUpdated: name
+    then: [count]
+  - name: first
+    on: hub
+    if:
+      onLabelAdded: Person
+    then: [unknown]
+  - name: third
+    on: event
+    if:
+      where:
+        - field: age
+    then: []
+    catch: unknown
+`), newRegistry(t, new(int)))
+
+	errs, ok := errors.Cause(err).(Errors)
+	if !assert.True(t, ok, "Errors") {
+		return
+	}
+
+	assert.Equal(t, Errors{
+		{Line: 7, Message: `selector "onFieldUpdated" conflicts with "onNodeUpdated"`},
+		{Line: 9, Message: `duplicate rule name "first", first defined at line 3`},
+		{Line: 13, Message: `unknown handler "unknown"`},
+		{Line: 12, Message: `unknown key "onLabelAdded"`},
+		{Line: 12, Message: `expected a selector, with, where or expr`},
+		{Line: 19, Message: `expected at least one handler`},
+		{Line: 20, Message: `unknown error handler "unknown"`},
+		{Line: 18, Message: `missing operator, expected one of [equals notEquals in matches exists isNull greaterThan greaterOrEqual lessThan lessOrEqual]`},
+		{Line: 17, Message: `expected a selector, with, where or expr`},
+	}, errs)
+
+	_, err = Parse([]byte("rules: [\n"), NewRegistry())
+	assert.Error(t, err, "syntax error")
+}
+
+func TestParseLabel(t *testing.T) {
+	set, err := Parse([]byte(`
+rules:
+  - name: person
+    label: Person
+    on: event
+    if:
+      onNodeCreated:
+    then: count
+  - name: any
+    on: hub
+    if:
+      from: Person
+    then: count
+`), newRegistry(t, new(int)))
+	if !assert.NoError(t, err, "parse") {
+		return
+	}
+
+	assert.Equal(t, "Person", set.Events[0].Scope())
+	assert.Equal(t, "", set.Hubs[0].Scope())
+
+	_, err = Parse([]byte("rules:\n  - name: empty\n    label:\n    on: event\n    if: {onNodeCreated: }\n    then: count\n"), NewRegistry())
+	assert.Contains(t, err.Error(), "line 3: expected a non-empty string")
+}
+
+func TestParsePrecedence(t *testing.T) {
+	set, err := Parse([]byte(`
+rules:
+  - name: published
+    on: event
+    if:
+      onNodeCreated:
+      where:
+        field: status
+        equals: published
+      or:
+        - onNodeDeleted:
+    then: count
+  - name: visible
+    on: hub
+    if:
+      from: Person
+      with: visible
+      or:
+        - from: Photo
+      and:
+        - onNodeUpdated:
+    then: count
+`), newRegistry(t, new(int)))
+	if !assert.NoError(t, err, "parse") {
+		return
+	}
+
+	// (onNodeCreated && where) || onNodeDeleted
+	for _, tt := range []struct {
+		operation shared.Operation
+		status    string
+		want      bool
+	}{
+		{shared.CreatedOperation, "published", true},
+		{shared.CreatedOperation, "draft", false},
+		{shared.DeletedOperation, "draft", true},
+		{shared.UpdatedOperation, "published", false},
+	} {
+		evt := &shared.EventContext{
+			Operation:  tt.operation,
+			Properties: shared.Properties{"status": tt.status},
+		}
+		state := set.Events[0].Execute(nil, evt)
+		assert.Equal(t, tt.want, state == shared.ChainHandledStateThen, "%s %s", tt.operation, tt.status)
+	}
+
+	// ((from Person && with visible) || from Photo) && onNodeUpdated
+	for _, tt := range []struct {
+		sender    string
+		visible   bool
+		operation shared.Operation
+		want      bool
+	}{
+		{"Person", true, shared.UpdatedOperation, true},
+		{"Person", false, shared.UpdatedOperation, false},
+		{"Photo", false, shared.UpdatedOperation, true},
+		{"Photo", false, shared.CreatedOperation, false},
+	} {
+		hubCtx := &shared.HubContext{
+			Sender:     tt.sender,
+			Operation:  tt.operation,
+			Properties: shared.Properties{"visible": tt.visible},
+		}
+		state := set.Hubs[0].Execute(nil, hubCtx)
+		assert.Equal(t, tt.want, state == shared.ChainHandledStateThen, "%s %v %s", tt.sender, tt.visible, tt.operation)
+	}
+}
@@ -0,0 +1,99 @@
+package rules
+
+import (
+	"regexp"
+
+	"github.com/denkhaus/nksh/predicate"
+	"github.com/denkhaus/nksh/shared"
+	yaml "gopkg.in/yaml.v3"
+)
+
+var (
+	predicateOperators = []string{
+		"equals", "notEquals", "in", "matches", "exists", "isNull",
+		"greaterThan", "greaterOrEqual", "lessThan", "lessOrEqual",
+	}
+	predicateKeys = append([]string{"field"}, predicateOperators...)
+)
+
+func (p *compiler) value(n *yaml.Node) (interface{}, bool) {
+	var res interface{}
+	if n.Kind != yaml.ScalarNode || n.Decode(&res) != nil {
+		p.errorf(n, "expected a single value")
+		return nil, false
+	}
+	return res, true
+}
+
+// predicate compiles a where item, a field with exactly one operator of the predicate package:
+//
+//	field: status
+//	in: [active, pending]
+func (p *compiler) predicate(n *yaml.Node) shared.EvalFunc {
+	m, ok := p.mapping(n, predicateKeys)
+	if !ok || !p.require(n, m, "field") {
+		return nil
+	}
+
+	field := p.scalar(m["field"])
+	op := ""
+	for _, key := range predicateOperators {
+		if _, ok := m[key]; !ok {
+			continue
+		}
+		if op != "" {
+			p.errorf(m[key], "operator %q conflicts with %q", key, op)
+			continue
+		}
+		op = key
+	}
+
+	val := m[op]
+	switch op {
+	case "equals", "notEquals", "greaterThan", "greaterOrEqual", "lessThan", "lessOrEqual":
+		want, ok := p.value(val)
+		if !ok {
+			return nil
+		}
+		switch op {
+		case "equals":
+			return predicate.FieldEquals(field, want)
+		case "notEquals":
+			return predicate.Not(predicate.FieldEquals(field, want))
+		case "greaterThan":
+			return predicate.FieldGreaterThan(field, want)
+		case "greaterOrEqual":
+			return predicate.FieldGreaterOrEqual(field, want)
+		case "lessThan":
+			return predicate.FieldLessThan(field, want)
+		}
+		return predicate.FieldLessOrEqual(field, want)
+	case "in":
+		var want []interface{}
+		if val.Kind != yaml.SequenceNode || val.Decode(&want) != nil {
+			p.errorf(val, "expected a sequence of values")
+			return nil
+		}
+		return predicate.FieldIn(field, want...)
+	case "matches":
+		re, err := regexp.Compile(p.scalar(val))
+		if err != nil {
+			p.errorf(val, "invalid pattern: %s", err)
+			return nil
+		}
+		return predicate.FieldMatchesRegexp(field, re)
+	case "exists":
+		if p.boolean(val) {
+			return predicate.FieldExists(field)
+		}
+		return predicate.Not(predicate.FieldExists(field))
+	case "isNull":
+		if p.boolean(val) {
+			return predicate.FieldIsNull(field)
+		}
+		return predicate.Not(predicate.FieldIsNull(field))
+	}
+
+	p.errorf(n, "missing operator, expected one of %v", predicateOperators)
+	return nil
+}
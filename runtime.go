@@ -0,0 +1,365 @@
+package nksh
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/denkhaus/nksh/health"
+	"github.com/denkhaus/nksh/metrics"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	DefaultKafkaPort     = 9092
+	DefaultZookeeperPort = 2181
+	DefaultDNSRetries    = 50
+)
+
+type Option func(p *Runtime)
+
+// Runtime runs DispatcherFuncs until its context is done or a signal is received.
+type Runtime struct {
+	kafkaHost        string
+	kafkaPort        int
+	kafkaBrokers     []string
+	zookeeperHost    string
+	zookeeperPort    int
+	zookeeperServers []string
+	dnsRetries       int
+	ctx              context.Context
+	signals          []os.Signal
+	shutdownTimeout  time.Duration
+	log              logrus.FieldLogger
+	graphClient      shared.GraphClient
+	keyStrategy      shared.KeyStrategy
+	topicManager     shared.TopicManagerFactory
+	provisioned      []shared.EntityDescriptor
+	hubTopicSpec     *shared.TopicSpec
+	topics           []shared.Topic
+	metricsAddr      string
+	healthAddr       string
+	healthOpts       []health.Option
+}
+
+// WithKafkaHost sets the host whose DNS records resolve to the kafka brokers.
+func WithKafkaHost(host string) Option {
+	return func(p *Runtime) {
+		p.kafkaHost = host
+	}
+}
+
+func WithKafkaPort(port int) Option {
+	return func(p *Runtime) {
+		p.kafkaPort = port
+	}
+}
+
+// WithKafkaBrokers sets a static list of brokers, bypassing the DNS lookup.
+func WithKafkaBrokers(brokers ...string) Option {
+	return func(p *Runtime) {
+		p.kafkaBrokers = brokers
+	}
+}
+
+// WithZookeeperHost sets the host whose DNS records resolve to the zookeeper servers.
+func WithZookeeperHost(host string) Option {
+	return func(p *Runtime) {
+		p.zookeeperHost = host
+	}
+}
+
+func WithZookeeperPort(port int) Option {
+	return func(p *Runtime) {
+		p.zookeeperPort = port
+	}
+}
+
+// WithZookeeperServers sets a static list of zookeeper servers, bypassing the DNS lookup.
+func WithZookeeperServers(servers ...string) Option {
+	return func(p *Runtime) {
+		p.zookeeperServers = servers
+	}
+}
+
+func WithDNSRetries(retries int) Option {
+	return func(p *Runtime) {
+		p.dnsRetries = retries
+	}
+}
+
+// WithContext sets the parent context, the runtime stops when it is done.
+func WithContext(ctx context.Context) Option {
+	return func(p *Runtime) {
+		p.ctx = ctx
+	}
+}
+
+// WithSignals sets the signals stopping the runtime. Without
+// signals no signal handler is installed at all.
+func WithSignals(signals ...os.Signal) Option {
+	return func(p *Runtime) {
+		p.signals = signals
+	}
+}
+
+// WithShutdownTimeout limits the time the DispatcherFuncs get to return after
+// the runtime stopped. A timeout <= 0 waits forever.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(p *Runtime) {
+		p.shutdownTimeout = timeout
+	}
+}
+
+func WithLogger(logger logrus.FieldLogger) Option {
+	return func(p *Runtime) {
+		p.log = logger
+	}
+}
+
+// WithTopicManager sets how all DispatcherFuncs check and create their topics,
+// e.g. shared.KafkaAdminTopicManager for clusters without ZooKeeper.
+func WithTopicManager(factory shared.TopicManagerFactory) Option {
+	return func(p *Runtime) {
+		p.topicManager = factory
+	}
+}
+
+// WithTopicProvisioning creates or validates the topics of descrs before any
+// DispatcherFunc is started, see shared.DescriptorTopics.
+func WithTopicProvisioning(descrs ...shared.EntityDescriptor) Option {
+	return func(p *Runtime) {
+		p.provisioned = append(p.provisioned, descrs...)
+	}
+}
+
+// WithHubTopicSpec provisions the hub stream shared by the descriptors with spec
+// instead of the most partitions and replicas of their specs, see shared.HubTopicSpec.
+func WithHubTopicSpec(spec shared.TopicSpec) Option {
+	return func(p *Runtime) {
+		p.hubTopicSpec = &spec
+	}
+}
+
+// WithTopics provisions topics in addition to those of the descriptors,
+// e.g. the shared.GroupTopics of the tx consumer.
+func WithTopics(topics ...shared.Topic) Option {
+	return func(p *Runtime) {
+		p.topics = append(p.topics, topics...)
+	}
+}
+
+// WithMetrics records prometheus metrics of all DispatcherFuncs,
+// served on addr at /metrics.
+func WithMetrics(addr string) Option {
+	return func(p *Runtime) {
+		p.metricsAddr = addr
+	}
+}
+
+// WithHealth serves the liveness of the DispatcherFuncs on addr at /healthz
+// and their readiness at /readyz. The graph database is checked with the
+// GraphClient of the runtime, or the global neo4j driver if assigned,
+// unless opts define otherwise.
+func WithHealth(addr string, opts ...health.Option) Option {
+	return func(p *Runtime) {
+		p.healthAddr = addr
+		p.healthOpts = opts
+	}
+}
+
+// WithGraphClient sets the GraphClient used by the chains of all consumers
+// started by the runtime, instead of the global neo4j driver.
+func WithGraphClient(client shared.GraphClient) Option {
+	return func(p *Runtime) {
+		p.graphClient = client
+	}
+}
+
+// WithKeyStrategy sets the KeyStrategy the consumers started by the runtime
+// compose their message keys with, instead of the global one.
+func WithKeyStrategy(strategy shared.KeyStrategy) Option {
+	return func(p *Runtime) {
+		p.keyStrategy = strategy
+	}
+}
+
+func NewRuntime(opts ...Option) *Runtime {
+	rt := Runtime{
+		kafkaPort:     DefaultKafkaPort,
+		zookeeperPort: DefaultZookeeperPort,
+		dnsRetries:    DefaultDNSRetries,
+		ctx:           context.Background(),
+		signals:       []os.Signal{syscall.SIGINT, syscall.SIGTERM},
+		log:           log,
+	}
+
+	for _, opt := range opts {
+		opt(&rt)
+	}
+
+	return &rt
+}
+
+func (p *Runtime) resolve(servers []string, host string, port int) ([]string, error) {
+	if len(servers) > 0 {
+		return servers, nil
+	}
+
+	if host == "" {
+		return nil, errors.New("neither servers nor host defined")
+	}
+
+	return lookupClusterHosts(host, port, p.dnsRetries)
+}
+
+func (p *Runtime) wait(grp *errgroup.Group) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- grp.Wait()
+	}()
+
+	if p.shutdownTimeout <= 0 {
+		return <-done
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(p.shutdownTimeout):
+		return errors.Errorf("shutdown timed out after %s", p.shutdownTimeout)
+	}
+}
+
+func (p *Runtime) provision(ctx context.Context, kServers, zServers []string) error {
+	hubSpec := shared.HubTopicSpec(p.provisioned...)
+	if p.hubTopicSpec != nil {
+		hubSpec = *p.hubTopicSpec
+	}
+
+	topics, err := shared.DescriptorTopics(hubSpec, p.provisioned...)
+	if err != nil {
+		return errors.Annotate(err, "DescriptorTopics")
+	}
+
+	topics = append(topics, p.topics...)
+	if len(topics) == 0 {
+		return nil
+	}
+
+	tm, err := shared.TopicManagerBuilder(ctx, zServers)(kServers)
+	if err != nil {
+		return errors.Annotate(err, "TopicManagerBuilder")
+	}
+	defer tm.Close()
+
+	return shared.ProvisionTopics(tm, topics...)
+}
+
+// Run starts all funcs and blocks until the runtime is stopped and all funcs returned.
+func (p *Runtime) Run(funcs ...shared.DispatcherFunc) error {
+	kServers, err := p.resolve(p.kafkaBrokers, p.kafkaHost, p.kafkaPort)
+	if err != nil {
+		return errors.Annotate(err, "resolve [kafka]")
+	}
+
+	// zookeeper is optional, without it topics are managed through the kafka admin API
+	var zServers []string
+	if len(p.zookeeperServers) > 0 || p.zookeeperHost != "" {
+		zServers, err = p.resolve(p.zookeeperServers, p.zookeeperHost, p.zookeeperPort)
+		if err != nil {
+			return errors.Annotate(err, "resolve [zookeeper]")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(p.ctx)
+	defer cancel()
+	if p.graphClient != nil {
+		ctx = shared.ContextWithGraphClient(ctx, p.graphClient)
+	}
+	if p.keyStrategy != nil {
+		ctx = shared.ContextWithKeyStrategy(ctx, p.keyStrategy)
+	}
+	if p.topicManager != nil {
+		ctx = shared.ContextWithTopicManager(ctx, p.topicManager)
+	}
+
+	if err := p.provision(ctx, kServers, zServers); err != nil {
+		return errors.Annotate(err, "provision")
+	}
+
+	eps := endpoints{}
+	if p.metricsAddr != "" {
+		reg := prometheus.NewRegistry()
+		m, err := metrics.NewPrometheus(reg)
+		if err != nil {
+			return errors.Annotate(err, "NewPrometheus")
+		}
+		ctx = shared.ContextWithMetrics(ctx, m)
+		eps.handle(p.metricsAddr, "/metrics", metrics.Handler(reg))
+	}
+
+	if p.healthAddr != "" {
+		// without a client or a global driver there is no graph database to check
+		opts := p.healthOpts
+		if p.graphClient != nil || shared.Neo4jDriver != nil {
+			opts = append([]health.Option{
+				health.WithGraphClient(shared.GraphClientFromContext(ctx)),
+			}, opts...)
+		}
+
+		checker := health.NewChecker(opts...)
+		ctx = shared.ContextWithHealth(ctx, checker)
+		go checker.Run(ctx)
+
+		eps.handle(p.healthAddr, "/healthz", checker.LiveHandler())
+		eps.handle(p.healthAddr, "/readyz", checker.ReadyHandler())
+	}
+
+	stopEndpoints, err := eps.serve(p.log)
+	if err != nil {
+		return errors.Annotate(err, "serve")
+	}
+	defer stopEndpoints()
+
+	grp, ctx := errgroup.WithContext(ctx)
+
+	p.log.Infof("startup with kafka hosts %v", kServers)
+	p.log.Infof("startup with zookeeper hosts %v", zServers)
+
+	// all funcs register their processors before any of them runs
+	runs := make([]func() error, 0, len(funcs))
+	for _, fn := range funcs {
+		runs = append(runs, fn(ctx, kServers, zServers))
+	}
+	for _, run := range runs {
+		grp.Go(run)
+	}
+
+	var waiter chan os.Signal
+	if len(p.signals) > 0 {
+		waiter = make(chan os.Signal, 1)
+		signal.Notify(waiter, p.signals...)
+		defer signal.Stop(waiter)
+	}
+
+	select {
+	case sig := <-waiter:
+		p.log.Infof("received signal %s", sig)
+	case <-ctx.Done():
+	}
+
+	cancel()
+	if err := p.wait(grp); err != nil {
+		return errors.Annotate(err, "Wait")
+	}
+
+	p.log.Info("dispatcher finished")
+	return nil
+}
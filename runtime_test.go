@@ -0,0 +1,153 @@
+package nksh
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/denkhaus/nksh/graphtest"
+	"github.com/denkhaus/nksh/health"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+// untilDone returns a DispatcherFunc returning err once its context is done,
+// it reports the servers and the context it was started with to started.
+func untilDone(started chan<- []string, err error) shared.DispatcherFunc {
+	return func(ctx context.Context, kServers, zServers []string) func() error {
+		return func() error {
+			started <- append(kServers, zServers...)
+			<-ctx.Done()
+			return err
+		}
+	}
+}
+
+func TestRuntimeRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := graphtest.NewClient()
+	clients := make(chan shared.GraphClient, 1)
+	keys := make(chan shared.KeyStrategy, 1)
+	started := make(chan []string, 2)
+
+	rt := NewRuntime(
+		WithContext(ctx),
+		WithSignals(),
+		WithKafkaBrokers("kafka:9092"),
+		WithZookeeperServers("zk:2181"),
+		WithGraphClient(client),
+		WithKeyStrategy(shared.KeyStrategyFunc(func(label string, id int64) string {
+			return label
+		})),
+	)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- rt.Run(
+			untilDone(started, nil),
+			func(ctx context.Context, kServers, zServers []string) func() error {
+				clients <- shared.GraphClientFromContext(ctx)
+				keys <- shared.KeyStrategyFromContext(ctx)
+				return untilDone(started, nil)(ctx, kServers, zServers)
+			},
+		)
+	}()
+
+	assert.Equal(t, []string{"kafka:9092", "zk:2181"}, <-started, "servers")
+	assert.Equal(t, []string{"kafka:9092", "zk:2181"}, <-started, "servers")
+	assert.True(t, <-clients == client, "graph client of the runtime")
+	assert.Equal(t, "Person", (<-keys).Key("Person", 1004), "key strategy of the runtime")
+
+	cancel()
+	assert.NoError(t, <-done, "stopped by context")
+}
+
+func TestRuntimeHealthWithoutGraph(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	checkers := make(chan *health.Checker, 1)
+	started := make(chan []string, 1)
+
+	rt := NewRuntime(
+		WithContext(ctx),
+		WithSignals(),
+		WithKafkaBrokers("kafka:9092"),
+		WithHealth("127.0.0.1:0"),
+	)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- rt.Run(func(ctx context.Context, kServers, zServers []string) func() error {
+			checkers <- shared.HealthFromContext(ctx).(*health.Checker)
+			return untilDone(started, nil)(ctx, kServers, zServers)
+		})
+	}()
+
+	checker := <-checkers
+	<-started
+	assert.Nil(t, shared.Neo4jDriver, "no global driver")
+	assert.NoError(t, checker.Ping(), "graph database not checked")
+	assert.Empty(t, checker.Ready(), "ready without graph client")
+
+	cancel()
+	assert.NoError(t, <-done, "stopped by context")
+}
+
+func TestRuntimeSignal(t *testing.T) {
+	started := make(chan []string, 1)
+	rt := NewRuntime(
+		WithSignals(syscall.SIGUSR1),
+		WithKafkaBrokers("kafka:9092"),
+	)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- rt.Run(untilDone(started, nil))
+	}()
+
+	assert.Equal(t, []string{"kafka:9092"}, <-started, "without zookeeper")
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1), "send signal")
+	assert.NoError(t, <-done, "stopped by signal")
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	err := NewRuntime(WithSignals()).Run()
+	assert.EqualError(t, err, "resolve [kafka]: neither servers nor host defined")
+
+	started := make(chan []string, 2)
+	failing := func(ctx context.Context, kServers, zServers []string) func() error {
+		return func() error {
+			return errors.New("boom")
+		}
+	}
+	err = NewRuntime(WithSignals(), WithKafkaBrokers("kafka:9092")).Run(untilDone(started, nil), failing)
+	assert.EqualError(t, err, "Wait: boom", "failing func stops all funcs")
+}
+
+func TestRuntimeWait(t *testing.T) {
+	rt := NewRuntime(WithShutdownTimeout(10 * time.Millisecond))
+
+	grp := &errgroup.Group{}
+	grp.Go(func() error { return errors.New("boom") })
+	assert.EqualError(t, rt.wait(grp), "boom", "returned in time")
+
+	release := make(chan struct{})
+	defer close(release)
+	grp = &errgroup.Group{}
+	grp.Go(func() error {
+		<-release
+		return nil
+	})
+	assert.EqualError(t, rt.wait(grp), "shutdown timed out after 10ms")
+
+	rt = NewRuntime()
+	grp = &errgroup.Group{}
+	grp.Go(func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	assert.NoError(t, rt.wait(grp), "without timeout")
+}
@@ -0,0 +1,33 @@
+package shared
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/lann/builder"
+)
+
+// Chain is implemented by the lann/builder based Executables of the event, hub and
+// tx packages. PrepareChain sets their fields with builder.Set, so the result is of
+// the Executable type of the package.
+type Chain interface {
+	Name() string
+}
+
+// PrepareChain applies descr, unless nil, and the GraphClient, Metrics and KeyStrategy of the
+// dispatcher context to chain. A chain keeps its own GraphClient and is named by its position idx
+// unless named otherwise.
+func PrepareChain(ctx context.Context, descr EntityDescriptor, idx int, chain Chain) Chain {
+	if descr != nil {
+		chain = builder.Set(chain, "EntityDescriptor", descr).(Chain)
+	}
+	if _, ok := builder.Get(chain, "GraphClient"); !ok {
+		chain = builder.Set(chain, "GraphClient", GraphClientFromContext(ctx)).(Chain)
+	}
+	if chain.Name() == "" {
+		chain = builder.Set(chain, "Name", strconv.Itoa(idx)).(Chain)
+	}
+
+	chain = builder.Set(chain, "KeyStrategy", KeyStrategyFromContext(ctx)).(Chain)
+	return builder.Set(chain, "Metrics", MetricsFromContext(ctx)).(Chain)
+}
@@ -0,0 +1,58 @@
+package shared
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lann/builder"
+	"github.com/stretchr/testify/assert"
+)
+
+type testChainData struct {
+	EntityDescriptor EntityDescriptor
+	GraphClient      GraphClient
+	Metrics          Metrics
+	KeyStrategy      KeyStrategy
+	Name             string
+	Scope            string
+}
+
+type testChain builder.Builder
+
+func (b testChain) Name() string {
+	if name, ok := builder.Get(b, "Name"); ok {
+		return name.(string)
+	}
+	return ""
+}
+
+func (b testChain) Scope() string {
+	if scope, ok := builder.Get(b, "Scope"); ok {
+		return scope.(string)
+	}
+	return ""
+}
+
+var testChainBuilder = builder.Register(testChain{}, testChainData{}).(testChain)
+
+func TestPrepareChain(t *testing.T) {
+	client, own := &txClient{}, &txClient{}
+	ctx := ContextWithGraphClient(context.Background(), client)
+	descr := &testDescriptor{NewBaseDescriptor("Person")}
+
+	chain := PrepareChain(ctx, descr, 3, testChainBuilder)
+	data := builder.GetStruct(chain).(testChainData)
+	assert.Equal(t, "3", data.Name, "named by position")
+	assert.Equal(t, descr, data.EntityDescriptor)
+	assert.True(t, data.GraphClient == client, "client of the context")
+	assert.Equal(t, NopMetrics, data.Metrics)
+	assert.Equal(t, "Person-1004", data.KeyStrategy.Key("Person", 1004), "global key strategy")
+
+	named := builder.Set(testChainBuilder, "Name", "rename")
+	named = builder.Set(named, "GraphClient", own)
+	chain = PrepareChain(ctx, nil, 3, named.(testChain))
+	data = builder.GetStruct(chain).(testChainData)
+	assert.Equal(t, "rename", data.Name, "own name")
+	assert.Nil(t, data.EntityDescriptor, "no descriptor")
+	assert.True(t, data.GraphClient == own, "own client")
+}
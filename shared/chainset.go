@@ -0,0 +1,111 @@
+package shared
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+type chainSetVersion struct {
+	version int64
+	chains  interface{}
+}
+
+// ChainSet holds the chains of running consumers, e.g. the event and hub Executables
+// of a rule set. Store replaces them while the consumers are running, every message
+// is handled by the chains loaded when it arrives.
+type ChainSet struct {
+	current atomic.Value
+	mu      sync.Mutex
+}
+
+// NewChainSet holds chains as version 1.
+func NewChainSet(chains ...interface{}) *ChainSet {
+	s := ChainSet{}
+	s.current.Store(&chainSetVersion{version: 1, chains: chains})
+	return &s
+}
+
+// Load returns the current chains and their version.
+func (p *ChainSet) Load() ([]interface{}, int64) {
+	cur := p.current.Load().(*chainSetVersion)
+	return cur.chains.([]interface{}), cur.version
+}
+
+// Version returns the version of the current chains.
+func (p *ChainSet) Version() int64 {
+	_, version := p.Load()
+	return version
+}
+
+// Store replaces the chains and returns their version.
+func (p *ChainSet) Store(chains ...interface{}) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	version := p.Version() + 1
+	p.current.Store(&chainSetVersion{version: version, chains: chains})
+	return version
+}
+
+// scoped is implemented by chains that run only in the consumers of one descriptor.
+type scoped interface {
+	Scope() string
+}
+
+// PreparedChains prepares the chains of a ChainSet for one dispatcher, once per version.
+// It keeps the chains of the element type of its slice and drops chains scoped to the
+// label of another descriptor.
+type PreparedChains struct {
+	ctx      context.Context
+	descr    EntityDescriptor
+	set      *ChainSet
+	typ      reflect.Type
+	prepared atomic.Value
+}
+
+// NewPreparedChains prepares the chains of set of the element type of slice,
+// e.g. []event.Executable(nil), see PrepareChain.
+func NewPreparedChains(ctx context.Context, descr EntityDescriptor, set *ChainSet, slice interface{}) *PreparedChains {
+	p := PreparedChains{
+		ctx:   ctx,
+		descr: descr,
+		set:   set,
+		typ:   reflect.TypeOf(slice),
+	}
+	return &p
+}
+
+func (p *PreparedChains) inScope(chain interface{}) bool {
+	s, ok := chain.(scoped)
+	if !ok || s.Scope() == "" {
+		return true
+	}
+	return p.descr != nil && p.descr.Label() == s.Scope()
+}
+
+// Load returns the prepared chains of the current version as slice of the type given to
+// NewPreparedChains.
+func (p *PreparedChains) Load() interface{} {
+	chains, version := p.set.Load()
+	if cur, ok := p.prepared.Load().(*chainSetVersion); ok && cur.version == version {
+		return cur.chains
+	}
+
+	prepared := reflect.MakeSlice(p.typ, 0, len(chains))
+	idx := 0
+	for _, chain := range chains {
+		if chain == nil || !reflect.TypeOf(chain).AssignableTo(p.typ.Elem()) {
+			continue
+		}
+		if p.inScope(chain) {
+			chain = PrepareChain(p.ctx, p.descr, idx, chain.(Chain))
+			prepared = reflect.Append(prepared, reflect.ValueOf(chain))
+		}
+		idx++
+	}
+
+	p.prepared.Store(&chainSetVersion{version: version, chains: prepared.Interface()})
+	return prepared.Interface()
+}
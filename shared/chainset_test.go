@@ -0,0 +1,41 @@
+package shared
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lann/builder"
+	"github.com/stretchr/testify/assert"
+)
+
+func chainNames(chains []Chain) []string {
+	names := []string{}
+	for _, chain := range chains {
+		names = append(names, chain.Name())
+	}
+	return names
+}
+
+func TestChainSet(t *testing.T) {
+	person := builder.Set(testChainBuilder, "Scope", "Person").(testChain)
+	photo := builder.Set(builder.Set(testChainBuilder, "Scope", "Photo"), "Name", "photo").(testChain)
+
+	set := NewChainSet(testChainBuilder, "no chain", person, photo)
+	assert.Equal(t, int64(1), set.Version())
+
+	prepared := NewPreparedChains(context.Background(), &testDescriptor{NewBaseDescriptor("Person")}, set, []Chain(nil))
+	chains := prepared.Load().([]Chain)
+	assert.Equal(t, []string{"0", "1"}, chainNames(chains), "chains in scope")
+	assert.True(t, &prepared.Load().([]Chain)[0] == &chains[0], "prepared once per version")
+
+	unscoped := NewPreparedChains(context.Background(), nil, set, []Chain(nil))
+	assert.Equal(t, []string{"0"}, chainNames(unscoped.Load().([]Chain)), "without descriptor")
+
+	assert.Equal(t, int64(2), set.Store(photo))
+	assert.Equal(t, int64(2), set.Version())
+	assert.Empty(t, prepared.Load().([]Chain), "next version")
+
+	typed := NewPreparedChains(context.Background(), nil, set, []testChain(nil))
+	set.Store(testChainBuilder, "no chain")
+	assert.Len(t, typed.Load().([]testChain), 1, "chains of the element type")
+}
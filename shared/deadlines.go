@@ -0,0 +1,106 @@
+package shared
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/storage"
+)
+
+// DeadlineFunc returns the deadline stored in an encoded group table value,
+// the zero time if there is none.
+type DeadlineFunc func(value []byte) (time.Time, error)
+
+// Deadlines tracks the keys of a group table with a pending deadline, so Poll can send
+// a message to each key once its deadline passed. The handlers of the group Set the
+// deadlines they store in the table, UpdateCallback restores them while the table is
+// recovered, which is why Options keeps the table in memory: every start of the
+// processor recovers the whole table, after a restart as after a rebalance.
+type Deadlines struct {
+	deadline DeadlineFunc
+	keys     map[string]time.Time
+	mu       sync.Mutex
+}
+
+func NewDeadlines(deadline DeadlineFunc) *Deadlines {
+	d := Deadlines{
+		deadline: deadline,
+		keys:     make(map[string]time.Time),
+	}
+	return &d
+}
+
+// Set tracks the deadline of key, a zero deadline stops tracking it.
+func (p *Deadlines) Set(key string, deadline time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if deadline.IsZero() {
+		delete(p.keys, key)
+		return
+	}
+	p.keys[key] = deadline
+}
+
+// Due stops tracking the keys whose deadline passed at now and returns them ordered.
+func (p *Deadlines) Due(now time.Time) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys := []string{}
+	for key, deadline := range p.keys {
+		if !deadline.After(now) {
+			keys = append(keys, key)
+			delete(p.keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// UpdateCallback tracks the deadlines of the recovered table values, see goka.WithUpdateCallback.
+func (p *Deadlines) UpdateCallback(s storage.Storage, partition int32, key string, value []byte) error {
+	deadline := time.Time{}
+	if value != nil {
+		d, err := p.deadline(value)
+		if err != nil {
+			return errors.Annotatef(err, "deadline [%s]", key)
+		}
+		deadline = d
+	}
+
+	p.Set(key, deadline)
+	return goka.DefaultUpdate(s, partition, key, value)
+}
+
+// Options returns the processor options the group table needs to be recovered into p.
+func (p *Deadlines) Options() []goka.ProcessorOption {
+	return []goka.ProcessorOption{
+		goka.WithStorageBuilder(storage.MemoryBuilder()),
+		goka.WithUpdateCallback(p.UpdateCallback),
+	}
+}
+
+// Poll calls send for each due key every interval until ctx is done.
+// Keys send fails for are tried again with the next interval.
+func (p *Deadlines) Poll(ctx context.Context, interval time.Duration, send func(key string) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, key := range p.Due(now) {
+				if err := send(key); err != nil {
+					log.Error(errors.Annotatef(err, "send [%s]", key))
+					p.Set(key, now)
+				}
+			}
+		}
+	}
+}
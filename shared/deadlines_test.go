@@ -0,0 +1,53 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadlines(t *testing.T) {
+	now := time.Now()
+	d := NewDeadlines(func(value []byte) (time.Time, error) {
+		if string(value) == "invalid" {
+			return time.Time{}, errors.New("invalid deadline")
+		}
+		return time.Parse(time.RFC3339Nano, string(value))
+	})
+
+	d.Set("1", now)
+	d.Set("2", now.Add(time.Second))
+	d.Set("3", now.Add(-time.Second))
+	d.Set("4", now)
+	d.Set("4", time.Time{})
+	assert.Equal(t, []string{"1", "3"}, d.Due(now), "due keys")
+	assert.Empty(t, d.Due(now), "due keys are untracked")
+
+	st := storage.NewMemory()
+	assert.NoError(t, d.UpdateCallback(st, 0, "5", []byte(now.Format(time.RFC3339Nano))))
+	assert.NoError(t, d.UpdateCallback(st, 0, "2", nil))
+	assert.Error(t, d.UpdateCallback(st, 0, "6", []byte("invalid")))
+	value, err := st.Get("5")
+	assert.NoError(t, err)
+	assert.Equal(t, now.Format(time.RFC3339Nano), string(value), "recovered value")
+	assert.Equal(t, []string{"5"}, d.Due(now.Add(time.Second)), "recovered keys")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sent := make(chan string, 2)
+	fail := true
+	d.Set("7", now)
+	go d.Poll(ctx, time.Millisecond, func(key string) error {
+		if fail {
+			fail = false
+			return errors.New("send failed")
+		}
+		sent <- key
+		return nil
+	})
+	assert.Equal(t, "7", <-sent, "sent again after failure")
+	cancel()
+}
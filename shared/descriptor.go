@@ -21,12 +21,19 @@ type EntityDescriptor interface {
 	EventInputStream() goka.Stream
 	EventOutputStream() goka.Stream
 	EventGroup() goka.Group
+	RetryStream() goka.Stream
+	DeadLetterStream() goka.Stream
+	RetryGroup() goka.Group
+	RetryPolicy() *RetryPolicy
+	TopicSpec() TopicSpec
 	ContextDef() ContextDefinition
 	Label() string
 }
 
 type BaseDescriptor struct {
-	label string
+	label       string
+	retryPolicy *RetryPolicy
+	topicSpec   *TopicSpec
 }
 
 func (p *BaseDescriptor) Label() string {
@@ -57,6 +64,41 @@ func (p *BaseDescriptor) HubOutputStream() goka.Stream {
 	return HubStream
 }
 
+func (p *BaseDescriptor) RetryGroup() goka.Group {
+	return goka.Group(fmt.Sprintf("%s_Retry", p.label))
+}
+
+func (p *BaseDescriptor) RetryStream() goka.Stream {
+	return goka.Stream(fmt.Sprintf("Retry%s", p.label))
+}
+
+func (p *BaseDescriptor) DeadLetterStream() goka.Stream {
+	return goka.Stream(fmt.Sprintf("DLQ%s", p.label))
+}
+
+// RetryPolicy returns nil if failed messages are not routed.
+func (p *BaseDescriptor) RetryPolicy() *RetryPolicy {
+	return p.retryPolicy
+}
+
+// SetRetryPolicy enables the routing of failed messages to the
+// retry and dead letter stream of the descriptor.
+func (p *BaseDescriptor) SetRetryPolicy(policy *RetryPolicy) {
+	p.retryPolicy = policy
+}
+
+// TopicSpec returns the settings the topics of the descriptor are provisioned with.
+func (p *BaseDescriptor) TopicSpec() TopicSpec {
+	if p.topicSpec == nil {
+		return DefaultTopicSpec
+	}
+	return *p.topicSpec
+}
+
+func (p *BaseDescriptor) SetTopicSpec(spec TopicSpec) {
+	p.topicSpec = &spec
+}
+
 func NewBaseDescriptor(label string) *BaseDescriptor {
 	d := &BaseDescriptor{
 		label: label,
@@ -0,0 +1,48 @@
+package shared
+
+import (
+	"context"
+
+	"github.com/lovoo/goka"
+)
+
+type processorOptionsKey struct{}
+type emitterOptionsKey struct{}
+
+// ContextWithProcessorOptions returns a copy of ctx, which lets the DispatcherFuncs
+// started with it pass opts to all their processors.
+func ContextWithProcessorOptions(ctx context.Context, opts ...goka.ProcessorOption) context.Context {
+	return context.WithValue(ctx, processorOptionsKey{},
+		append(processorOptions(ctx), opts...),
+	)
+}
+
+func processorOptions(ctx context.Context) []goka.ProcessorOption {
+	opts, _ := ctx.Value(processorOptionsKey{}).([]goka.ProcessorOption)
+	return append([]goka.ProcessorOption{}, opts...)
+}
+
+// ProcessorOptions returns defaults followed by the options of ctx,
+// so the options of ctx take precedence.
+func ProcessorOptions(ctx context.Context, defaults ...goka.ProcessorOption) []goka.ProcessorOption {
+	return append(defaults, processorOptions(ctx)...)
+}
+
+// ContextWithEmitterOptions returns a copy of ctx, which lets the DispatcherFuncs
+// started with it pass opts to all their emitters.
+func ContextWithEmitterOptions(ctx context.Context, opts ...goka.EmitterOption) context.Context {
+	return context.WithValue(ctx, emitterOptionsKey{},
+		append(emitterOptions(ctx), opts...),
+	)
+}
+
+func emitterOptions(ctx context.Context) []goka.EmitterOption {
+	opts, _ := ctx.Value(emitterOptionsKey{}).([]goka.EmitterOption)
+	return append([]goka.EmitterOption{}, opts...)
+}
+
+// EmitterOptions returns defaults followed by the options of ctx,
+// so the options of ctx take precedence.
+func EmitterOptions(ctx context.Context, defaults ...goka.EmitterOption) []goka.EmitterOption {
+	return append(defaults, emitterOptions(ctx)...)
+}
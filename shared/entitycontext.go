@@ -1,10 +1,115 @@
 package shared
 
+import (
+	"github.com/juju/errors"
+)
+
+// EntityContext holds the rows returned by the queries of an EntityDescriptors
+// ContextDefinition, keyed by the name of the query. Rows holds all rows of a
+// query, Context the first one, as it did before Rows was added.
 type EntityContext struct {
 	NodeID  int64
 	Context map[string]Properties
+	Rows    map[string][]Properties
+}
+
+func NewEntityContext(nodeID int64) *EntityContext {
+	ctx := EntityContext{
+		NodeID:  nodeID,
+		Context: make(map[string]Properties),
+		Rows:    make(map[string][]Properties),
+	}
+	return &ctx
 }
 
 func (p *EntityContext) Append(key string, prop Properties) {
+	if p.Context == nil {
+		p.Context = make(map[string]Properties)
+	}
+	if p.Rows == nil {
+		p.Rows = make(map[string][]Properties)
+	}
+	if _, ok := p.Context[key]; !ok {
+		p.Context[key] = prop
+	}
+	p.Rows[key] = append(p.Rows[key], prop)
+}
+
+// Get returns the rows of key, or the row assigned to Context by code
+// written before Rows was added.
+func (p *EntityContext) Get(key string) []Properties {
+	if rows, ok := p.Rows[key]; ok {
+		return rows
+	}
+	if row, ok := p.Context[key]; ok {
+		return []Properties{row}
+	}
+	return nil
+}
+
+func (p *EntityContext) Count(key string) int {
+	return len(p.Get(key))
+}
+
+// First returns the first row of key or nil if there is none.
+func (p *EntityContext) First(key string) Properties {
+	if rows := p.Get(key); len(rows) > 0 {
+		return rows[0]
+	}
+	return nil
+}
+
+// first returns the first row of key or a NotFound error if there is none.
+func (p *EntityContext) first(key string) (Properties, error) {
+	if row := p.First(key); row != nil {
+		return row, nil
+	}
+	return nil, errors.NotFoundf("rows of %s", key)
+}
+
+// String returns field of the first row of key, it converts like Properties.GetString.
+func (p *EntityContext) String(key, field string) (string, error) {
+	row, err := p.first(key)
+	if err != nil {
+		return "", err
+	}
+	return row.GetString(field)
+}
+
+// Bool returns field of the first row of key, it converts like Properties.GetBool.
+func (p *EntityContext) Bool(key, field string) (bool, error) {
+	row, err := p.first(key)
+	if err != nil {
+		return false, err
+	}
+	return row.GetBool(field)
+}
+
+// Int64 returns field of the first row of key, it converts like Properties.GetInt64.
+func (p *EntityContext) Int64(key, field string) (int64, error) {
+	row, err := p.first(key)
+	if err != nil {
+		return 0, err
+	}
+	return row.GetInt64(field)
+}
+
+// Float64 returns field of the first row of key, it converts like Properties.GetFloat.
+func (p *EntityContext) Float64(key, field string) (float64, error) {
+	row, err := p.first(key)
+	if err != nil {
+		return 0, err
+	}
+	return row.GetFloat(field)
+}
 
+// Strings collects field of all rows of key that hold a string.
+func (p *EntityContext) Strings(key, field string) []string {
+	res := []string{}
+	for _, row := range p.Get(key) {
+		if value, ok := row[field].(string); ok {
+			res = append(res, value)
+		}
+	}
+	return res
 }
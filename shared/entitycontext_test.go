@@ -0,0 +1,61 @@
+package shared
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntityContext(t *testing.T) {
+	ctx := NewEntityContext(7)
+	assert.Equal(t, int64(7), ctx.NodeID)
+	assert.Equal(t, 0, ctx.Count("friends"))
+	assert.Nil(t, ctx.First("friends"))
+
+	ctx.Append("friends", Properties{"name": "Anne", "age": json.Number("42"), "score": 2.5, "active": true})
+	ctx.Append("friends", Properties{"name": "Bob", "age": "17"})
+	ctx.Append("friends", Properties{"age": 3})
+
+	assert.Equal(t, 3, ctx.Count("friends"))
+	assert.Len(t, ctx.Get("friends"), 3)
+	assert.Equal(t, "Anne", ctx.First("friends")["name"])
+	assert.Equal(t, []string{"Anne", "Bob"}, ctx.Strings("friends", "name"))
+	assert.Equal(t, []string{}, ctx.Strings("enemies", "name"))
+
+	name, err := ctx.String("friends", "name")
+	assert.NoError(t, err)
+	assert.Equal(t, "Anne", name)
+
+	age, err := ctx.Int64("friends", "age")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), age)
+
+	score, err := ctx.Float64("friends", "score")
+	assert.NoError(t, err)
+	assert.Equal(t, 2.5, score)
+
+	active, err := ctx.Bool("friends", "active")
+	assert.NoError(t, err)
+	assert.True(t, active)
+
+	_, err = ctx.Int64("friends", "score")
+	assert.EqualError(t, err, "field score: cannot convert 2.5 to int64 without loss")
+
+	_, err = ctx.String("friends", "missing")
+	assert.True(t, errors.IsNotFound(err), "missing field")
+
+	_, err = ctx.Bool("enemies", "active")
+	assert.True(t, errors.IsNotFound(err), "missing rows")
+	assert.EqualError(t, err, "rows of enemies not found")
+
+	var empty EntityContext
+	empty.Append("friends", Properties{})
+	assert.Equal(t, 1, empty.Count("friends"))
+
+	assert.Equal(t, "Anne", ctx.Context["friends"]["name"], "first row in Context")
+	legacy := EntityContext{Context: map[string]Properties{"owner": {"name": "Carl"}}}
+	assert.Equal(t, 1, legacy.Count("owner"), "row assigned to Context")
+	assert.Equal(t, []string{"Carl"}, legacy.Strings("owner", "name"))
+}
@@ -0,0 +1,70 @@
+package shared
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Selector renders the selector name and its arguments for traces.
+func Selector(name string, args ...string) string {
+	if len(args) == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
+}
+
+// Branch is an Or, And or Not branch of an Evaluation.
+type Branch struct {
+	Selector string
+	Evaluate func(trace *Trace) bool
+}
+
+// Evaluation is a node of the condition tree of a chain bound to a message,
+// Arg is the message passed to Conditions. Match matches the message against
+// the selector of the node and conditions.
+type Evaluation struct {
+	Selector   string
+	Conditions EvalFuncs
+	Arg        interface{}
+	Match      func(conditions EvalFuncs) bool
+	Or         []Branch
+	And        []Branch
+	Not        []Branch
+}
+
+// Evaluate matches the node and its branches and records every evaluated
+// selector, condition and branch in trace, which may be nil. The result
+// is not set on trace, so callers may amend it.
+func (p *Evaluation) Evaluate(trace *Trace) bool {
+	result := p.Match(p.Conditions)
+
+	if trace != nil {
+		if p.Selector != "" {
+			trace.Add(TraceSelector, p.Selector, p.Match(nil))
+		}
+		for idx, cond := range p.Conditions {
+			trace.Add(TraceWith, fmt.Sprintf("#%d", idx), cond(p.Arg))
+		}
+	}
+
+	// without a trace branches are short-circuited
+	for _, b := range p.Or {
+		if trace == nil && result {
+			break
+		}
+		result = b.Evaluate(trace.Add(TraceOr, b.Selector, false)) || result
+	}
+	for _, b := range p.And {
+		if trace == nil && !result {
+			break
+		}
+		result = b.Evaluate(trace.Add(TraceAnd, b.Selector, false)) && result
+	}
+	for _, b := range p.Not {
+		if trace == nil && !result {
+			break
+		}
+		result = !b.Evaluate(trace.Add(TraceNot, b.Selector, false)) && result
+	}
+	return result
+}
@@ -84,24 +84,93 @@ func (p ChangeInfos) Deleted(field string) bool {
 	return false
 }
 
+type RelationshipInfo struct {
+	Type        string   `json:"type"`
+	StartID     int64    `json:"start_id"`
+	StartLabels []string `json:"start_labels"`
+	EndID       int64    `json:"end_id"`
+	EndLabels   []string `json:"end_labels"`
+}
+
+// EventContext describes a node event or, if Relationship is set,
+// a relationship event. NodeID holds the id of the relationship in that case.
+// A retried event carries the Chain that failed on it and its Attempt.
 type EventContext struct {
-	TimeStamp   time.Time   `json:"time_stamp"`
-	Operation   Operation   `json:"operation"`
-	NodeID      int64       `json:"node_id"`
-	ChangeInfos ChangeInfos `json:"change_infos"`
-	Properties  Properties  `json:"properties"`
+	TimeStamp     time.Time         `json:"time_stamp"`
+	Operation     Operation         `json:"operation"`
+	NodeID        int64             `json:"node_id"`
+	Labels        []string          `json:"labels"`
+	LabelChanges  ChangeInfos       `json:"label_changes"`
+	ChangeInfos   ChangeInfos       `json:"change_infos"`
+	Properties    Properties        `json:"properties"`
+	Relationship  *RelationshipInfo `json:"relationship,omitempty"`
+	TxID          int64             `json:"tx_id"`
+	TxEventID     int               `json:"tx_event_id"`
+	TxEventsCount int               `json:"tx_events_count"`
+	OwnWrite      bool              `json:"own_write"`
+	Attempt       int               `json:"attempt,omitempty"`
+	Chain         string            `json:"chain,omitempty"`
+}
+
+// IsOwnWrite reports whether the event echoes a write of the Executor.
+func (p *EventContext) IsOwnWrite() bool {
+	return p.ChangeInfos.Created(OwnWriteProperty) ||
+		p.ChangeInfos.Updated(OwnWriteProperty)
+}
+
+func (p *EventContext) EntityType() EntityType {
+	if p.Relationship != nil {
+		return RelationshipEntity
+	}
+	return NodeEntity
+}
+
+// HasLabel reports whether the node, or for relationships the start or end node, carries label.
+func (p *EventContext) HasLabel(label string) bool {
+	labels := p.Labels
+	if p.Relationship != nil {
+		labels = append(append([]string{},
+			p.Relationship.StartLabels...),
+			p.Relationship.EndLabels...,
+		)
+	}
+
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (p *EventContext) Match(
 
+	entityType EntityType,
+	relType string,
 	operation Operation,
 	fieldName string,
 	fieldOperation Operation,
+	labelName string,
+	labelOperation Operation,
 	conditions EvalFuncs,
 
 ) bool {
 
 	matcher := NewMatcher(
+		func() (bool, EvalFunc) {
+			return entityType != "",
+				func(_ interface{}) bool {
+					return p.EntityType() == entityType
+				}
+		},
+		func() (bool, EvalFunc) {
+			return relType != "" && relType != "*",
+				func(_ interface{}) bool {
+					return p.Relationship != nil &&
+						p.Relationship.Type == relType
+				}
+		},
 		func() (bool, EvalFunc) {
 			return p.Operation == UpdatedOperation &&
 					p.Operation == operation &&
@@ -119,6 +188,21 @@ func (p *EventContext) Match(
 					}
 				}
 		},
+		func() (bool, EvalFunc) {
+			return p.Operation == UpdatedOperation &&
+					p.Operation == operation &&
+					labelName != "" && labelOperation != "",
+				func(_ interface{}) bool {
+					switch labelOperation {
+					case CreatedOperation:
+						return p.LabelChanges.Created(labelName)
+					case DeletedOperation:
+						return p.LabelChanges.Deleted(labelName)
+					default:
+						return false
+					}
+				}
+		},
 		func() (bool, EvalFunc) {
 			return operation != "",
 				func(_ interface{}) bool {
@@ -131,6 +215,25 @@ func (p *EventContext) Match(
 	return matcher.Eval(*p)
 }
 
+// BuildLabelChanges records added labels as created and removed labels as deleted changes.
+func (p *EventContext) BuildLabelChanges(before, after []string) {
+	if p.LabelChanges == nil {
+		p.LabelChanges = make(ChangeInfos)
+	}
+
+	for _, label := range before {
+		p.LabelChanges[label] = ChangeInfo{Before: true}
+	}
+
+	for _, label := range after {
+		if _, ok := p.LabelChanges[label]; ok {
+			delete(p.LabelChanges, label)
+		} else {
+			p.LabelChanges[label] = ChangeInfo{After: true}
+		}
+	}
+}
+
 func (p *EventContext) BuildChanges(before bool, props map[string]interface{}) {
 	for field, value := range props {
 		if info, ok := p.ChangeInfos[field]; ok {
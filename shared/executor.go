@@ -1,6 +1,7 @@
 package shared
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/juju/errors"
@@ -13,12 +14,13 @@ var (
 )
 
 var (
-	cypherApplyProperties = CypherQuery(`
+	cypherApplyProperties = CypherQuery(fmt.Sprintf(`
 		MATCH (p) 
 		WHERE ID(p) = $id
 		SET p+= $ctx 
 		SET p.modifiedAt = $modifiedAt		
-	`)
+		SET p.%s = $writeID
+	`, OwnWriteProperty))
 	cypherEnumerateSuperOrdinates = CypherQuery(`
 		MATCH (super)-[]->(p) 
 		WHERE id(p) = $id 
@@ -40,8 +42,8 @@ func NewExecutor(ctx *HandlerContext) *Executor {
 	return &ex
 }
 
-func (p *Executor) newSession() (neo4j.Session, error) {
-	session, err := Neo4jDriver.Session(neo4j.AccessModeWrite)
+func (p *Executor) newSession() (GraphSession, error) {
+	session, err := p.Graph().Session(neo4j.AccessModeWrite)
 	if err != nil {
 		return nil, errors.Annotate(err, "Session")
 	}
@@ -79,17 +81,37 @@ func (p *Executor) enumerateSuperOrdinates(
 	return nil
 }
 
+func toProperties(value interface{}) (Properties, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return Properties(v), nil
+	case neo4j.Node:
+		return Properties(v.Props()), nil
+	case neo4j.Relationship:
+		return Properties(v.Props()), nil
+	default:
+		return nil, errors.Errorf("unsupported result type %T", value)
+	}
+}
+
+// BuildEntityContext runs all queries of the descriptors ContextDefinition for nodeID
+// and collects the "result" column of every returned row.
 func (p *Executor) BuildEntityContext(nodeID int64) (*EntityContext, error) {
-	ctx := EntityContext{
-		NodeID: nodeID,
+	if p.EntityDescriptor == nil {
+		return nil, errors.New("entity descriptor undefined")
 	}
 
+	ctx := NewEntityContext(nodeID)
 	for entity, query := range p.EntityDescriptor.ContextDef() {
 		err := p.Run(query, Properties{
 			"id": nodeID,
 		}, func(record neo4j.Record) error {
-			if res, ok := record.Get("result"); ok {
-				ctx.Append(entity, res.(map[string]interface{}))
+			if res, ok := record.Get("result"); ok && res != nil {
+				props, err := toProperties(res)
+				if err != nil {
+					return errors.Annotatef(err, "toProperties [%s]", entity)
+				}
+				ctx.Append(entity, props)
 			}
 			return nil
 		})
@@ -98,7 +120,7 @@ func (p *Executor) BuildEntityContext(nodeID int64) (*EntityContext, error) {
 		}
 	}
 
-	return &ctx, nil
+	return ctx, nil
 }
 
 func (p *Executor) NotifySuperOrdinates(
@@ -123,7 +145,7 @@ func (p *Executor) NotifySuperOrdinates(
 			}
 
 			log.Infof("%s->%s notify superordinate:%v", sender, msg.Receiver, msg)
-			p.GokaContext.Emit(HubStream, ComposeKey(msg.Receiver, id), msg)
+			p.GokaContext.Emit(HubStream, p.ComposeKey(msg.Receiver, id), msg)
 		}
 
 		return nil
@@ -137,6 +159,7 @@ func (p *Executor) ApplyProperties(nodeID int64, ctx Properties) error {
 		Properties{
 			"id":         nodeID,
 			"modifiedAt": time.Now().UTC(),
+			"writeID":    RandStringBytes(16),
 			"ctx":        ctx,
 		}, nil)
 
@@ -147,17 +170,33 @@ func (p *Executor) ApplyProperties(nodeID int64, ctx Properties) error {
 	return nil
 }
 
-func (p *Executor) Run(cypher CypherQuery, ctx Properties, onRecord OnRecordFunc) error {
-	session, err := p.newSession()
-	if err != nil {
-		return errors.Annotate(err, "newSession")
-	}
+// Run executes cypher within the chain transaction if there is one, or in an
+// auto-commit transaction of a new session otherwise.
+func (p *Executor) Run(cypher CypherQuery, ctx Properties, onRecord OnRecordFunc) (err error) {
+	defer func(start time.Time) {
+		p.Measure().QueryExecuted(LabelOf(p.EntityDescriptor), p.Chain, time.Since(start), err)
+	}(time.Now())
+
+	var result neo4j.Result
+	if p.Transaction != nil {
+		res, err := p.Transaction.Run(cypher.String(), ctx)
+		if err != nil {
+			return errors.Annotate(err, "Run")
+		}
+		result = res
+	} else {
+		session, err := p.newSession()
+		if err != nil {
+			return errors.Annotate(err, "newSession")
+		}
 
-	defer session.Close()
+		defer session.Close()
 
-	result, err := session.Run(cypher.String(), ctx)
-	if err != nil {
-		return errors.Annotate(err, "Run")
+		res, err := session.Run(cypher.String(), ctx)
+		if err != nil {
+			return errors.Annotate(err, "Run")
+		}
+		result = res
 	}
 
 	if onRecord != nil {
@@ -168,7 +207,7 @@ func (p *Executor) Run(cypher CypherQuery, ctx Properties, onRecord OnRecordFunc
 		}
 	}
 
-	if err = result.Err(); err != nil {
+	if err := result.Err(); err != nil {
 		return errors.Annotate(err, "Err")
 	}
 
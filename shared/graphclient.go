@@ -0,0 +1,97 @@
+package shared
+
+import (
+	"context"
+
+	"github.com/juju/errors"
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+)
+
+// GraphRunner runs cypher statements.
+type GraphRunner interface {
+	Run(cypher string, params map[string]interface{}) (neo4j.Result, error)
+}
+
+type GraphTransaction interface {
+	GraphRunner
+	Commit() error
+	Rollback() error
+	Close() error
+}
+
+type GraphSession interface {
+	GraphRunner
+	BeginTransaction() (GraphTransaction, error)
+	Close() error
+}
+
+// GraphClient is the access to the graph database used by the Executor.
+type GraphClient interface {
+	Session(mode neo4j.AccessMode) (GraphSession, error)
+}
+
+type driverSession struct {
+	session neo4j.Session
+}
+
+func (p *driverSession) Run(cypher string, params map[string]interface{}) (neo4j.Result, error) {
+	return p.session.Run(cypher, params)
+}
+
+func (p *driverSession) BeginTransaction() (GraphTransaction, error) {
+	return p.session.BeginTransaction()
+}
+
+func (p *driverSession) Close() error {
+	return p.session.Close()
+}
+
+type driverClient struct {
+	driver func() neo4j.Driver
+}
+
+func (p *driverClient) Session(mode neo4j.AccessMode) (GraphSession, error) {
+	driver := p.driver()
+	if driver == nil {
+		return nil, errors.New("neo4j driver undefined")
+	}
+
+	session, err := driver.Session(mode)
+	if err != nil {
+		return nil, errors.Annotate(err, "Session")
+	}
+
+	return &driverSession{session}, nil
+}
+
+// NewDriverClient returns a GraphClient using driver.
+func NewDriverClient(driver neo4j.Driver) GraphClient {
+	return &driverClient{
+		driver: func() neo4j.Driver {
+			return driver
+		},
+	}
+}
+
+// DefaultGraphClient uses the driver assigned to Neo4jDriver at the time a session is opened.
+var DefaultGraphClient GraphClient = &driverClient{
+	driver: func() neo4j.Driver {
+		return Neo4jDriver
+	},
+}
+
+type graphClientKey struct{}
+
+// ContextWithGraphClient returns a copy of ctx, which lets the consumers
+// started with it inject client into their chains.
+func ContextWithGraphClient(ctx context.Context, client GraphClient) context.Context {
+	return context.WithValue(ctx, graphClientKey{}, client)
+}
+
+// GraphClientFromContext returns the GraphClient of ctx or DefaultGraphClient.
+func GraphClientFromContext(ctx context.Context) GraphClient {
+	if client, ok := ctx.Value(graphClientKey{}).(GraphClient); ok {
+		return client
+	}
+	return DefaultGraphClient
+}
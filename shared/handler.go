@@ -3,21 +3,33 @@ package shared
 import (
 	"sync"
 
+	"github.com/juju/errors"
 	"github.com/lovoo/goka"
+	"github.com/neo4j/neo4j-go-driver/neo4j"
 )
 
 type HandlerContext struct {
-	GokaContext      goka.Context
-	EntityDescriptor EntityDescriptor
-	EventContext     *EventContext
-	HubContext       *HubContext
-	store            map[string]interface{}
-	mu               sync.Mutex
+	GokaContext        goka.Context
+	EntityDescriptor   EntityDescriptor
+	EventContext       *EventContext
+	HubContext         *HubContext
+	TransactionContext *TransactionContext
+	GraphClient        GraphClient
+	Metrics            Metrics
+	KeyStrategy        KeyStrategy
+	Chain              string
+	Transaction        GraphTransaction
+	session            GraphSession
+	store              map[string]interface{}
+	mu                 sync.Mutex
 }
 
 func (p *HandlerContext) Set(key string, value interface{}) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	if p.store == nil {
+		p.store = make(map[string]interface{})
+	}
 	p.store[key] = value
 }
 
@@ -43,3 +55,96 @@ func (p *HandlerContext) GetEntityContext() *EntityContext {
 
 type Handler func(ctx *HandlerContext) error
 type Handlers []Handler
+
+// Graph returns the injected GraphClient or DefaultGraphClient.
+func (p *HandlerContext) Graph() GraphClient {
+	if p.GraphClient != nil {
+		return p.GraphClient
+	}
+	return DefaultGraphClient
+}
+
+// Measure returns the injected Metrics or NopMetrics.
+func (p *HandlerContext) Measure() Metrics {
+	if p.Metrics != nil {
+		return p.Metrics
+	}
+	return NopMetrics
+}
+
+// ComposeKey composes a message key with the injected KeyStrategy or the global one.
+func (p *HandlerContext) ComposeKey(label string, id int64) string {
+	if p.KeyStrategy != nil {
+		return p.KeyStrategy.Key(label, id)
+	}
+	return ComposeKey(label, id)
+}
+
+func (p *HandlerContext) beginTransaction() error {
+	session, err := p.Graph().Session(neo4j.AccessModeWrite)
+	if err != nil {
+		return errors.Annotate(err, "Session")
+	}
+
+	tx, err := session.BeginTransaction()
+	if err != nil {
+		session.Close()
+		return errors.Annotate(err, "BeginTransaction")
+	}
+
+	p.session = session
+	p.Transaction = tx
+	return nil
+}
+
+func (p *HandlerContext) endTransaction(commit bool) error {
+	defer func() {
+		p.session.Close()
+		p.session = nil
+		p.Transaction = nil
+	}()
+
+	if commit {
+		return errors.Annotate(p.Transaction.Commit(), "Commit")
+	}
+
+	return errors.Annotate(p.Transaction.Rollback(), "Rollback")
+}
+
+// ExecuteHandlers runs handlers in order and stops at the first error. In transactional
+// mode all handlers share one Neo4j transaction, which is committed only if every handler
+// succeeds and rolled back otherwise.
+func ExecuteHandlers(ctx *HandlerContext, handlers Handlers, transactional bool) error {
+	if !transactional {
+		for _, handle := range handlers {
+			if err := handle(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := ctx.beginTransaction(); err != nil {
+		return errors.Annotate(err, "beginTransaction")
+	}
+
+	// roll back and close the session on errors and on panics, which propagate afterwards
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		if err := ctx.endTransaction(false); err != nil {
+			log.Error(errors.Annotate(err, "endTransaction"))
+		}
+	}()
+
+	for _, handle := range handlers {
+		if err := handle(ctx); err != nil {
+			return err
+		}
+	}
+
+	committed = true
+	return errors.Annotate(ctx.endTransaction(true), "endTransaction")
+}
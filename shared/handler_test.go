@@ -0,0 +1,82 @@
+package shared
+
+import (
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+	"github.com/stretchr/testify/assert"
+)
+
+// txClient counts the transactions of ExecuteHandlers, it runs no cypher.
+type txClient struct {
+	commits, rollbacks, sessions int
+}
+
+func (p *txClient) Session(mode neo4j.AccessMode) (GraphSession, error) {
+	p.sessions++
+	return p, nil
+}
+
+func (p *txClient) Run(cypher string, params map[string]interface{}) (neo4j.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *txClient) BeginTransaction() (GraphTransaction, error) {
+	return p, nil
+}
+
+func (p *txClient) Commit() error {
+	p.commits++
+	return nil
+}
+
+func (p *txClient) Rollback() error {
+	p.rollbacks++
+	return nil
+}
+
+func (p *txClient) Close() error {
+	p.sessions--
+	return nil
+}
+
+func TestExecuteHandlers(t *testing.T) {
+	var calls []string
+	handler := func(name string, err error) Handler {
+		return func(ctx *HandlerContext) error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+
+	client := &txClient{}
+	ctx := &HandlerContext{GraphClient: client}
+
+	err := ExecuteHandlers(ctx, Handlers{handler("a", nil), handler("b", errors.New("failed")), handler("c", nil)}, false)
+	assert.EqualError(t, err, "failed")
+	assert.Equal(t, []string{"a", "b"}, calls, "stops at the first error")
+	assert.Equal(t, txClient{}, *client, "no transaction")
+
+	calls = nil
+	err = ExecuteHandlers(ctx, Handlers{handler("a", nil), handler("b", nil)}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, calls)
+	assert.Equal(t, txClient{commits: 1}, *client, "committed")
+	assert.Nil(t, ctx.Transaction, "transaction ended")
+
+	*client = txClient{}
+	err = ExecuteHandlers(ctx, Handlers{handler("a", errors.New("failed")), handler("b", nil)}, true)
+	assert.EqualError(t, err, "failed")
+	assert.Equal(t, txClient{rollbacks: 1}, *client, "rolled back")
+
+	*client = txClient{}
+	assert.Panics(t, func() {
+		ExecuteHandlers(ctx, Handlers{func(ctx *HandlerContext) error {
+			assert.NotNil(t, ctx.Transaction, "handler runs in transaction")
+			panic("handler panic")
+		}}, true)
+	})
+	assert.Equal(t, txClient{rollbacks: 1}, *client, "rolled back and closed on panic")
+	assert.Nil(t, ctx.Transaction, "transaction ended")
+}
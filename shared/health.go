@@ -0,0 +1,79 @@
+package shared
+
+import (
+	"context"
+
+	"github.com/juju/errors"
+	"github.com/lovoo/goka"
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+)
+
+// Health tracks the processors run by DispatcherFuncs.
+type Health interface {
+	// RegisterProcessor announces a processor when its DispatcherFunc is created, before
+	// any processor runs. Processors registered with the same name are tracked apart.
+	RegisterProcessor(name string) ProcessorHealth
+}
+
+// ProcessorHealth receives the state of a registered processor.
+type ProcessorHealth interface {
+	Started(recovered func() bool)
+	Stopped(err error)
+}
+
+type nopHealth struct{}
+
+func (nopHealth) RegisterProcessor(name string) ProcessorHealth { return nopHealth{} }
+func (nopHealth) Started(recovered func() bool)                 {}
+func (nopHealth) Stopped(err error)                             {}
+
+type healthKey struct{}
+
+// ContextWithHealth returns a copy of ctx, which lets the DispatcherFuncs
+// started with it report their processors to health.
+func ContextWithHealth(ctx context.Context, health Health) context.Context {
+	return context.WithValue(ctx, healthKey{}, health)
+}
+
+// HealthFromContext returns the Health of ctx or one discarding all reports.
+func HealthFromContext(ctx context.Context) Health {
+	if health, ok := ctx.Value(healthKey{}).(Health); ok {
+		return health
+	}
+	return nopHealth{}
+}
+
+// RegisterProcessor registers the processor of group with the Health of ctx.
+// DispatcherFuncs call it once per processor when they are created.
+func RegisterProcessor(ctx context.Context, group goka.Group) ProcessorHealth {
+	return HealthFromContext(ctx).RegisterProcessor(string(group))
+}
+
+// RunProcessor runs p until ctx is done and reports it to health, see RegisterProcessor.
+func RunProcessor(ctx context.Context, health ProcessorHealth, p *goka.Processor) error {
+	health.Started(p.Recovered)
+	err := p.Run(ctx)
+	health.Stopped(err)
+
+	return err
+}
+
+// PingGraph verifies client is able to run a query.
+func PingGraph(client GraphClient) error {
+	session, err := client.Session(neo4j.AccessModeRead)
+	if err != nil {
+		return errors.Annotate(err, "Session")
+	}
+	defer session.Close()
+
+	result, err := session.Run("RETURN 1", nil)
+	if err != nil {
+		return errors.Annotate(err, "Run")
+	}
+
+	if _, err := result.Consume(); err != nil {
+		return errors.Annotate(err, "Consume")
+	}
+
+	return errors.Annotate(result.Err(), "Err")
+}
@@ -11,6 +11,8 @@ type HubContext struct {
 	Receiver   string     `json:"receiver"`
 	ReceiverID int64      `json:"receiver_id"`
 	Properties Properties `json:"properties"`
+	Attempt    int        `json:"attempt,omitempty"`
+	Chain      string     `json:"chain,omitempty"`
 }
 
 func (p *HubContext) Match(
@@ -0,0 +1,55 @@
+package shared
+
+import (
+	"context"
+	"time"
+
+	"github.com/lovoo/goka"
+)
+
+// Metrics receives the measurements of consumers and executors. label is the label
+// of the EntityDescriptor, chain the name of the chain, both may be empty.
+type Metrics interface {
+	MessageConsumed(label string, stream goka.Stream)
+	DecodeFailed(label string, stream goka.Stream)
+	MessageUnroutable(receiver string, stream goka.Stream)
+	ChainHandled(label, chain string, state ChainHandledState, duration time.Duration)
+	QueryExecuted(label, chain string, duration time.Duration, err error)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) MessageConsumed(label string, stream goka.Stream) {}
+func (nopMetrics) DecodeFailed(label string, stream goka.Stream)    {}
+func (nopMetrics) MessageUnroutable(receiver string, stream goka.Stream) {
+}
+func (nopMetrics) ChainHandled(label, chain string, state ChainHandledState, duration time.Duration) {
+}
+func (nopMetrics) QueryExecuted(label, chain string, duration time.Duration, err error) {}
+
+// NopMetrics discards all measurements.
+var NopMetrics Metrics = nopMetrics{}
+
+type metricsKey struct{}
+
+// ContextWithMetrics returns a copy of ctx, which lets the DispatcherFuncs
+// started with it report to metrics.
+func ContextWithMetrics(ctx context.Context, metrics Metrics) context.Context {
+	return context.WithValue(ctx, metricsKey{}, metrics)
+}
+
+// MetricsFromContext returns the Metrics of ctx or NopMetrics.
+func MetricsFromContext(ctx context.Context) Metrics {
+	if metrics, ok := ctx.Value(metricsKey{}).(Metrics); ok {
+		return metrics
+	}
+	return NopMetrics
+}
+
+// LabelOf returns the label of descr or "" if descr is nil.
+func LabelOf(descr EntityDescriptor) string {
+	if descr == nil {
+		return ""
+	}
+	return descr.Label()
+}
@@ -0,0 +1,523 @@
+package shared
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+var (
+	SRIDWGS84       = 4326
+	SRIDWGS843D     = 4979
+	SRIDCartesian   = 7203
+	SRIDCartesian3D = 9157
+)
+
+// crsSRIDs maps the crs names of points serialized by neo4j streams to their SRID.
+var crsSRIDs = map[string]int{
+	"wgs-84":       SRIDWGS84,
+	"wgs-84-3d":    SRIDWGS843D,
+	"cartesian":    SRIDCartesian,
+	"cartesian-3d": SRIDCartesian3D,
+}
+
+// temporalLayouts are the string formats of the neo4j temporal types DateTime,
+// LocalDateTime, Date, Time and LocalTime.
+var temporalLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"15:04:05.999999999Z07:00",
+	"15:04:05.999999999",
+}
+
+// Point is a spatial value, Z is NaN for two dimensional points.
+// Geographic points hold the longitude in X and the latitude in Y.
+type Point struct {
+	SRID int
+	X    float64
+	Y    float64
+	Z    float64
+}
+
+func (p Point) Is3D() bool {
+	return !math.IsNaN(p.Z)
+}
+
+type neo4jPoint interface {
+	SrId() int
+	X() float64
+	Y() float64
+	Z() float64
+}
+
+type neo4jTemporal interface {
+	Time() time.Time
+}
+
+// get returns the value of field or a NotFound error.
+func (p Properties) get(field string) (interface{}, error) {
+	if val, ok := p[field]; ok {
+		return val, nil
+	}
+	return nil, errors.NotFoundf("field %s", field)
+}
+
+func (p Properties) GetString(field string) (string, error) {
+	val, err := p.get(field)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := val.(string); ok {
+		return s, nil
+	}
+	return "", errors.Errorf("field %s: cannot convert %T to string", field, val)
+}
+
+func (p Properties) GetBool(field string) (bool, error) {
+	val, err := p.get(field)
+	if err != nil {
+		return false, err
+	}
+	if b, ok := val.(bool); ok {
+		return b, nil
+	}
+	return false, errors.Errorf("field %s: cannot convert %T to bool", field, val)
+}
+
+// GetInt64 converts any integral number, including float64 values decoded from json and numeric strings.
+func (p Properties) GetInt64(field string) (int64, error) {
+	val, err := p.get(field)
+	if err != nil {
+		return 0, err
+	}
+	i, err := toInt64(val)
+	return i, errors.Annotatef(err, "field %s", field)
+}
+
+// GetFloat converts any number, including json.Number and numeric strings.
+func (p Properties) GetFloat(field string) (float64, error) {
+	val, err := p.get(field)
+	if err != nil {
+		return 0, err
+	}
+	f, err := toFloat64(val)
+	return f, errors.Annotatef(err, "field %s", field)
+}
+
+// GetTime converts neo4j temporal values and their string formats, e.g.
+// 2019-03-04T10:11:12.5+01:00[Europe/Berlin], 2019-03-04 or 10:11:12.
+// Numbers are taken as milliseconds since the epoch, like the timestamps of neo4j streams.
+// Values without offset are in UTC, times without date on January 1, year 0.
+func (p Properties) GetTime(field string) (time.Time, error) {
+	val, err := p.get(field)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := toTime(val)
+	return t, errors.Annotatef(err, "field %s", field)
+}
+
+// GetStringSlice converts lists whose elements are all strings.
+func (p Properties) GetStringSlice(field string) ([]string, error) {
+	val, err := p.get(field)
+	if err != nil {
+		return nil, err
+	}
+	s, err := toStringSlice(val)
+	return s, errors.Annotatef(err, "field %s", field)
+}
+
+// GetMap converts nested maps, e.g. the json objects of map properties.
+func (p Properties) GetMap(field string) (Properties, error) {
+	val, err := p.get(field)
+	if err != nil {
+		return nil, err
+	}
+	m, err := toMap(val)
+	return m, errors.Annotatef(err, "field %s", field)
+}
+
+// GetPoint converts neo4j points and their neo4j streams serialization
+// {"crs": "wgs-84", "latitude": 52.5, "longitude": 13.4}.
+func (p Properties) GetPoint(field string) (Point, error) {
+	val, err := p.get(field)
+	if err != nil {
+		return Point{}, err
+	}
+	pt, err := toPoint(val)
+	return pt, errors.Annotatef(err, "field %s", field)
+}
+
+// Decode maps the properties into the struct into points to. Fields are matched by
+// their json tag or else their name and converted like the Get accessors convert,
+// properties without field and fields without property are skipped.
+func (p Properties) Decode(into interface{}) error {
+	v := reflect.ValueOf(into)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.Errorf("cannot decode into %T, expected a pointer to a struct", into)
+	}
+	return decodeStruct(p, v.Elem())
+}
+
+// AsInt64 converts integer types and integral json.Numbers, it reports false
+// for any other value, including floats and integers overflowing int64.
+func AsInt64(val interface{}) (int64, bool) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// AsFloat64 converts any number type and json.Number, it reports false for any other value.
+func AsFloat64(val interface{}) (float64, bool) {
+	if i, ok := AsInt64(val); ok {
+		return float64(i), true
+	}
+
+	switch v := val.(type) {
+	case uint:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// toInt64 extends AsInt64 to integral floats and numeric strings.
+func toInt64(val interface{}) (int64, error) {
+	if i, ok := AsInt64(val); ok {
+		return i, nil
+	}
+
+	switch v := val.(type) {
+	case json.Number:
+		return toInt64(string(v))
+	case string:
+		if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return toInt64(f)
+		}
+	case float32:
+		return toInt64(float64(v))
+	case float64:
+		// 2^63 is the first float64 above MaxInt64
+		if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+			return int64(v), nil
+		}
+		return 0, errors.Errorf("cannot convert %v to int64 without loss", v)
+	}
+	return 0, errors.Errorf("cannot convert %T to int64", val)
+}
+
+// toFloat64 extends AsFloat64 to numeric strings.
+func toFloat64(val interface{}) (float64, error) {
+	if f, ok := AsFloat64(val); ok {
+		return f, nil
+	}
+
+	if v, ok := val.(string); ok {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f, nil
+		}
+		return 0, errors.Errorf("cannot convert %q to float64", v)
+	}
+	return 0, errors.Errorf("cannot convert %T to float64", val)
+}
+
+func toTime(val interface{}) (time.Time, error) {
+	switch v := val.(type) {
+	case time.Time:
+		return v, nil
+	case neo4jTemporal:
+		return v.Time(), nil
+	case string:
+		return parseTemporal(v)
+	}
+
+	if ms, err := toInt64(val); err == nil {
+		return time.Unix(0, ms*int64(time.Millisecond)).UTC(), nil
+	}
+	return time.Time{}, errors.Errorf("cannot convert %T to time.Time", val)
+}
+
+// parseTemporal parses the string formats of neo4j temporal values,
+// a zone id suffix like [Europe/Berlin] sets the location if it is known.
+func parseTemporal(s string) (time.Time, error) {
+	var zone string
+	if i := strings.Index(s, "["); i > 0 && strings.HasSuffix(s, "]") {
+		s, zone = s[:i], s[i+1:len(s)-1]
+	}
+
+	for _, layout := range temporalLayouts {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			continue
+		}
+		if zone != "" {
+			if loc, err := time.LoadLocation(zone); err == nil {
+				t = t.In(loc)
+			}
+		}
+		return t, nil
+	}
+
+	return time.Time{}, errors.Errorf("cannot parse %q as temporal value", s)
+}
+
+func toStringSlice(val interface{}) ([]string, error) {
+	switch v := val.(type) {
+	case []string:
+		return v, nil
+	case []interface{}:
+		res := make([]string, 0, len(v))
+		for idx, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, errors.Errorf("cannot convert element %d of type %T to string", idx, item)
+			}
+			res = append(res, s)
+		}
+		return res, nil
+	}
+	return nil, errors.Errorf("cannot convert %T to []string", val)
+}
+
+func toMap(val interface{}) (Properties, error) {
+	switch v := val.(type) {
+	case Properties:
+		return v, nil
+	case map[string]interface{}:
+		return Properties(v), nil
+	}
+	return nil, errors.Errorf("cannot convert %T to map", val)
+}
+
+func toPoint(val interface{}) (Point, error) {
+	switch v := val.(type) {
+	case Point:
+		return v, nil
+	case neo4jPoint:
+		return Point{SRID: v.SrId(), X: v.X(), Y: v.Y(), Z: v.Z()}, nil
+	}
+
+	m, err := toMap(val)
+	if err != nil {
+		return Point{}, errors.Errorf("cannot convert %T to point", val)
+	}
+
+	crs, _ := m.GetString("crs")
+	srid, ok := crsSRIDs[crs]
+	if !ok {
+		return Point{}, errors.Errorf("unknown crs %q", crs)
+	}
+
+	x, y, z := "x", "y", "z"
+	if srid == SRIDWGS84 || srid == SRIDWGS843D {
+		x, y, z = "longitude", "latitude", "height"
+	}
+
+	pt := Point{SRID: srid, Z: math.NaN()}
+	if pt.X, err = m.GetFloat(x); err != nil {
+		return Point{}, err
+	}
+	if pt.Y, err = m.GetFloat(y); err != nil {
+		return Point{}, err
+	}
+	if srid == SRIDWGS843D || srid == SRIDCartesian3D {
+		if pt.Z, err = m.GetFloat(z); err != nil {
+			return Point{}, err
+		}
+	}
+	return pt, nil
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	pointType = reflect.TypeOf(Point{})
+)
+
+func decodeStruct(props Properties, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag = strings.Split(tag, ",")[0]; tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+		} else if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if err := decodeStruct(props, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		val, ok := props[name]
+		if !ok {
+			continue
+		}
+		if err := decodeValue(val, v.Field(i)); err != nil {
+			return errors.Annotatef(err, "field %s", name)
+		}
+	}
+
+	return nil
+}
+
+func decodeValue(val interface{}, v reflect.Value) error {
+	if val == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		t, err := toTime(val)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case pointType:
+		pt, err := toPoint(val)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(pt))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := decodeValue(val, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Interface:
+		rv := reflect.ValueOf(val)
+		if !rv.Type().AssignableTo(v.Type()) {
+			return errors.Errorf("cannot assign %T to %s", val, v.Type())
+		}
+		v.Set(rv)
+	case reflect.String:
+		s, ok := val.(string)
+		if !ok {
+			return errors.Errorf("cannot convert %T to string", val)
+		}
+		v.SetString(s)
+	case reflect.Bool:
+		b, ok := val.(bool)
+		if !ok {
+			return errors.Errorf("cannot convert %T to bool", val)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := toInt64(val)
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(i) {
+			return errors.Errorf("%d overflows %s", i, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := toInt64(val)
+		if err != nil {
+			return err
+		}
+		if i < 0 || v.OverflowUint(uint64(i)) {
+			return errors.Errorf("%d overflows %s", i, v.Type())
+		}
+		v.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat64(val)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		rv := reflect.ValueOf(val)
+		if rv.Kind() != reflect.Slice {
+			return errors.Errorf("cannot convert %T to %s", val, v.Type())
+		}
+		s := reflect.MakeSlice(v.Type(), rv.Len(), rv.Len())
+		for idx := 0; idx < rv.Len(); idx++ {
+			if err := decodeValue(rv.Index(idx).Interface(), s.Index(idx)); err != nil {
+				return errors.Annotatef(err, "element %d", idx)
+			}
+		}
+		v.Set(s)
+	case reflect.Map:
+		m, err := toMap(val)
+		if err != nil {
+			return err
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return errors.Errorf("cannot decode into %s, expected string keys", v.Type())
+		}
+		res := reflect.MakeMapWithSize(v.Type(), len(m))
+		for key, item := range m {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeValue(item, elem); err != nil {
+				return errors.Annotatef(err, "key %s", key)
+			}
+			res.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+		v.Set(res)
+	case reflect.Struct:
+		m, err := toMap(val)
+		if err != nil {
+			return err
+		}
+		return decodeStruct(m, v)
+	default:
+		return errors.Errorf("cannot decode into %s", v.Type())
+	}
+
+	return nil
+}
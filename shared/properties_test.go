@@ -0,0 +1,190 @@
+package shared
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var properties = `{
+	"name": "Anne",
+	"age": 42,
+	"score": 2.5,
+	"big": 9007199254740993,
+	"count": "17",
+	"born": "1977-03-04",
+	"seen": "2019-03-04T10:11:12.5+01:00[Europe/Berlin]",
+	"local": "2019-03-04T10:11:12",
+	"alarm": "07:30:00",
+	"created": 1532597182604,
+	"tags": ["a", "b"],
+	"mixed": ["a", 1],
+	"address": {"city": "Berlin", "zip": 10115},
+	"geo": [0.123, 46.2222, 32.11111],
+	"home": {"crs": "wgs-84", "latitude": 52.52, "longitude": 13.40},
+	"spot": {"crs": "cartesian-3d", "x": 1, "y": 2, "z": 3}
+}`
+
+func decodeProperties(t *testing.T) Properties {
+	var props Properties
+	assert.NoError(t, json.Unmarshal([]byte(properties), &props), "decode properties")
+	return props
+}
+
+func TestPropertiesGet(t *testing.T) {
+	props := decodeProperties(t)
+
+	i, err := props.GetInt64("age")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), i)
+	assert.Equal(t, int64(42), props.MustInt64("age"))
+
+	i, err = props.GetInt64("count")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(17), i)
+
+	_, err = props.GetInt64("score")
+	assert.EqualError(t, err, "field score: cannot convert 2.5 to int64 without loss")
+
+	_, err = props.GetInt64("missing")
+	assert.True(t, errors.IsNotFound(err), "not found")
+
+	f, err := props.GetFloat("score")
+	assert.NoError(t, err)
+	assert.Equal(t, 2.5, f)
+
+	f, err = Properties{"n": json.Number("1e3")}.GetFloat("n")
+	assert.NoError(t, err)
+	assert.Equal(t, 1000.0, f)
+
+	_, err = props.GetFloat("name")
+	assert.EqualError(t, err, `field name: cannot convert "Anne" to float64`)
+
+	tm, err := props.GetTime("born")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(1977, 3, 4, 0, 0, 0, 0, time.UTC), tm)
+
+	tm, err = props.GetTime("seen")
+	assert.NoError(t, err)
+	assert.True(t, time.Date(2019, 3, 4, 9, 11, 12, 5e8, time.UTC).Equal(tm))
+
+	tm, err = props.GetTime("local")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2019, 3, 4, 10, 11, 12, 0, time.UTC), tm)
+
+	tm, err = props.GetTime("alarm")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, tm.Hour())
+	assert.Equal(t, 30, tm.Minute())
+
+	tm, err = props.GetTime("created")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1532597182604), tm.UnixNano()/int64(time.Millisecond))
+
+	_, err = props.GetTime("name")
+	assert.EqualError(t, err, `field name: cannot parse "Anne" as temporal value`)
+
+	tags, err := props.GetStringSlice("tags")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, tags)
+
+	_, err = props.GetStringSlice("mixed")
+	assert.EqualError(t, err, "field mixed: cannot convert element 1 of type float64 to string")
+
+	address, err := props.GetMap("address")
+	assert.NoError(t, err)
+	assert.Equal(t, "Berlin", address.MustString("city"))
+
+	_, err = props.GetPoint("geo")
+	assert.EqualError(t, err, "field geo: cannot convert []interface {} to point")
+
+	pt, err := props.GetPoint("home")
+	assert.NoError(t, err)
+	assert.Equal(t, SRIDWGS84, pt.SRID)
+	assert.Equal(t, 13.40, pt.X)
+	assert.Equal(t, 52.52, pt.Y)
+	assert.False(t, pt.Is3D())
+
+	pt, err = props.GetPoint("spot")
+	assert.NoError(t, err)
+	assert.Equal(t, Point{SRID: SRIDCartesian3D, X: 1, Y: 2, Z: 3}, pt)
+
+	_, err = props.GetPoint("tags")
+	assert.Error(t, err)
+}
+
+func TestAsNumber(t *testing.T) {
+	for _, val := range []interface{}{int(7), int8(7), int16(7), int32(7), int64(7),
+		uint(7), uint8(7), uint16(7), uint32(7), uint64(7), json.Number("7")} {
+		i, ok := AsInt64(val)
+		assert.True(t, ok, "%T", val)
+		assert.Equal(t, int64(7), i, "%T", val)
+
+		f, ok := AsFloat64(val)
+		assert.True(t, ok, "%T", val)
+		assert.Equal(t, 7.0, f, "%T", val)
+	}
+
+	for _, val := range []interface{}{7.0, float32(7), json.Number("7.5"), uint64(1 << 63), "7", nil} {
+		_, ok := AsInt64(val)
+		assert.False(t, ok, "%T %v", val, val)
+	}
+
+	f, ok := AsFloat64(uint64(1 << 63))
+	assert.True(t, ok)
+	assert.Equal(t, float64(1<<63), f)
+
+	_, ok = AsFloat64("7")
+	assert.False(t, ok, "strings are no numbers")
+}
+
+func TestPropertiesDecode(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+		Zip  uint16 `json:"zip"`
+	}
+
+	var person struct {
+		Name    string            `json:"name"`
+		Age     int               `json:"age"`
+		Score   *float32          `json:"score"`
+		Count   int64             `json:"count"`
+		Born    time.Time         `json:"born"`
+		Tags    []string          `json:"tags"`
+		Address address           `json:"address"`
+		Home    Point             `json:"home"`
+		Geo     []float64         `json:"geo"`
+		Extra   map[string]string `json:"extra"`
+		Ignored string            `json:"-"`
+		Missing string
+	}
+
+	props := decodeProperties(t)
+	props["extra"] = map[string]interface{}{"a": "b"}
+	props["Ignored"] = "set"
+
+	if assert.NoError(t, props.Decode(&person)) {
+		assert.Equal(t, "Anne", person.Name)
+		assert.Equal(t, 42, person.Age)
+		assert.Equal(t, float32(2.5), *person.Score)
+		assert.Equal(t, int64(17), person.Count)
+		assert.Equal(t, 1977, person.Born.Year())
+		assert.Equal(t, []string{"a", "b"}, person.Tags)
+		assert.Equal(t, address{City: "Berlin", Zip: 10115}, person.Address)
+		assert.Equal(t, 52.52, person.Home.Y)
+		assert.Equal(t, []float64{0.123, 46.2222, 32.11111}, person.Geo)
+		assert.Equal(t, map[string]string{"a": "b"}, person.Extra)
+		assert.Empty(t, person.Ignored)
+		assert.Empty(t, person.Missing)
+	}
+
+	var invalid struct {
+		Age  uint8  `json:"big"`
+		Name string `json:"name"`
+	}
+	assert.EqualError(t, props.Decode(&invalid), "field big: 9007199254740992 overflows uint8")
+	assert.Error(t, props.Decode(invalid), "no pointer")
+}
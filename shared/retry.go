@@ -0,0 +1,165 @@
+package shared
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/lovoo/goka"
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+)
+
+// RetryPolicy decides whether and when a failed message is retried.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Retryable      func(err error) bool
+}
+
+func DefaultRetryPolicy() *RetryPolicy {
+	p := RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Minute,
+		Multiplier:     2,
+		Retryable:      IsRetryable,
+	}
+	return &p
+}
+
+// Backoff returns the delay before the given attempt, starting with attempt 1.
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+
+	return time.Duration(backoff)
+}
+
+// ShouldRetry reports whether a message that failed attempts times with err is retried.
+func (p *RetryPolicy) ShouldRetry(err error, attempts int) bool {
+	if attempts >= p.MaxAttempts {
+		return false
+	}
+	if p.Retryable == nil {
+		return IsRetryable(err)
+	}
+	return p.Retryable(err)
+}
+
+type retryableError struct {
+	error
+}
+
+func (p retryableError) Retryable() bool {
+	return true
+}
+
+// Retryable marks err as retryable for IsRetryable.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return retryableError{err}
+}
+
+// IsRetryable reports whether the cause of err was marked by Retryable or
+// is a transient Neo4j error.
+func IsRetryable(err error) bool {
+	cause := errors.Cause(err)
+	if r, ok := cause.(interface{ Retryable() bool }); ok {
+		return r.Retryable()
+	}
+
+	return neo4j.IsTransientError(cause) ||
+		neo4j.IsServiceUnavailable(cause) ||
+		neo4j.IsSessionExpired(cause)
+}
+
+// FailedMessage wraps a message whose Chain failed, for the retry and the dead letter stream.
+type FailedMessage struct {
+	Stream   goka.Stream       `json:"stream"`
+	Key      string            `json:"key"`
+	Chain    string            `json:"chain"`
+	Payload  json.RawMessage   `json:"payload"`
+	Attempt  int               `json:"attempt"`
+	Errors   []string          `json:"errors"`
+	State    ChainHandledState `json:"state"`
+	FailedAt time.Time         `json:"failed_at"`
+	RetryAt  time.Time         `json:"retry_at"`
+}
+
+type FailedMessageCodec struct{}
+
+func (p *FailedMessageCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (p *FailedMessageCodec) Decode(data []byte) (interface{}, error) {
+	var m FailedMessage
+	return &m, json.Unmarshal(data, &m)
+}
+
+// RoutesFailures reports whether failed messages of descr are routed by RouteFailure.
+func RoutesFailures(descr EntityDescriptor) bool {
+	return descr != nil && descr.RetryPolicy() != nil
+}
+
+// RouteFailure emits msg, on which chain failed for the attempt-th time with state and err,
+// to the retry stream of descr, or to its dead letter stream if err is not retryable or the
+// attempts are exhausted. The chain and attempt counter of msg must already be set, so the
+// retried msg runs the failed chain only.
+func RouteFailure(
+
+	ctx goka.Context,
+	descr EntityDescriptor,
+	chain string,
+	attempt int,
+	msg interface{},
+	state ChainHandledState,
+	err error,
+
+) error {
+
+	policy := descr.RetryPolicy()
+	if policy == nil {
+		return nil
+	}
+
+	payload, mErr := json.Marshal(msg)
+	if mErr != nil {
+		return errors.Annotate(mErr, "Marshal")
+	}
+
+	failed := FailedMessage{
+		Stream:   ctx.Topic(),
+		Key:      ctx.Key(),
+		Chain:    chain,
+		Payload:  payload,
+		Attempt:  attempt,
+		State:    state,
+		FailedAt: time.Now().UTC(),
+	}
+
+	if err != nil {
+		failed.Errors = strings.Split(errors.ErrorStack(err), "\n")
+	}
+
+	if err != nil && policy.ShouldRetry(err, attempt) {
+		failed.RetryAt = failed.FailedAt.Add(policy.Backoff(attempt))
+		ctx.Emit(descr.RetryStream(), ctx.Key(), &failed)
+		return nil
+	}
+
+	ctx.Emit(descr.DeadLetterStream(), ctx.Key(), &failed)
+	return nil
+}
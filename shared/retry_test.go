@@ -0,0 +1,77 @@
+package shared
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/lovoo/goka"
+	"github.com/stretchr/testify/assert"
+)
+
+type gokaContext = goka.Context
+
+// routeContext records the messages emitted by RouteFailure.
+type routeContext struct {
+	gokaContext
+	streams []goka.Stream
+	values  []interface{}
+}
+
+func (p *routeContext) Topic() goka.Stream {
+	return "Input2Person"
+}
+
+func (p *routeContext) Key() string {
+	return "Person-1004"
+}
+
+func (p *routeContext) Emit(stream goka.Stream, key string, value interface{}) {
+	p.streams = append(p.streams, stream)
+	p.values = append(p.values, value)
+}
+
+func TestRouteFailure(t *testing.T) {
+	descr := &testDescriptor{NewBaseDescriptor("Person")}
+	descr.SetRetryPolicy(&RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: time.Second,
+		Multiplier:     2,
+	})
+
+	msg := &EventContext{NodeID: 1004, Attempt: 1, Chain: "rename"}
+	ctx := &routeContext{}
+
+	err := RouteFailure(ctx, descr, msg.Chain, msg.Attempt, msg,
+		ChainHandledStateThenFailed, Retryable(errors.New("busy")))
+	assert.NoError(t, err, "route retryable failure")
+
+	msg.Attempt = 2
+	err = RouteFailure(ctx, descr, msg.Chain, msg.Attempt, msg,
+		ChainHandledStateThenFailed, Retryable(errors.New("busy")))
+	assert.NoError(t, err, "route exhausted failure")
+
+	err = RouteFailure(ctx, descr, msg.Chain, 1, msg,
+		ChainHandledStateElseFailed, errors.New("invalid"))
+	assert.NoError(t, err, "route permanent failure")
+
+	assert.Equal(t, []goka.Stream{descr.RetryStream(), descr.DeadLetterStream(), descr.DeadLetterStream()}, ctx.streams)
+
+	retry := ctx.values[0].(*FailedMessage)
+	assert.Equal(t, goka.Stream("Input2Person"), retry.Stream)
+	assert.Equal(t, "Person-1004", retry.Key)
+	assert.Equal(t, "rename", retry.Chain)
+	assert.Equal(t, 1, retry.Attempt)
+	assert.Equal(t, time.Second, retry.RetryAt.Sub(retry.FailedAt), "backoff")
+
+	var payload EventContext
+	assert.NoError(t, json.Unmarshal(retry.Payload, &payload), "decode payload")
+	assert.Equal(t, int64(1004), payload.NodeID)
+	assert.Equal(t, "rename", payload.Chain)
+
+	dead := ctx.values[2].(*FailedMessage)
+	assert.Equal(t, ChainHandledStateElseFailed, dead.State, "failed state")
+	assert.NotEmpty(t, dead.Errors, "error chain")
+	assert.True(t, dead.RetryAt.IsZero(), "not retried")
+}
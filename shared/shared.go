@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"sync"
 
 	"github.com/lovoo/goka"
 	"github.com/neo4j/neo4j-go-driver/neo4j"
@@ -30,6 +31,13 @@ var (
 	DeletedOperation = Operation("deleted")
 )
 
+type EntityType string
+
+var (
+	NodeEntity         = EntityType("node")
+	RelationshipEntity = EntityType("relationship")
+)
+
 var (
 	HubStream  = goka.Stream("Hub")  // Hubmessages Entity-> Hub
 	HubGroup   = goka.Group("Hub")   // Hubmessages Entity-> Hub
@@ -40,6 +48,10 @@ var (
 	Neo4jDriver neo4j.Driver
 )
 
+// OwnWriteProperty is changed on every write of the Executor,
+// which lets consumers recognise the echo of their own writes.
+const OwnWriteProperty = "nksh_write_id"
+
 type ChainHandledState int
 
 func (p ChainHandledState) Failed() bool {
@@ -80,16 +92,76 @@ func (p Properties) MustBool(field string) bool {
 	panic(fmt.Sprintf("Properties:MustBool: field %s not of type bool", field))
 }
 
+// MustInt64 converts numbers like GetInt64.
 func (p Properties) MustInt64(field string) int64 {
-	if value, ok := p.MustGet(field).(int64); ok {
+	p.MustGet(field)
+	if value, err := p.GetInt64(field); err == nil {
 		return value
 	}
 
 	panic(fmt.Sprintf("Properties:MustInt64: field %s not of type int64", field))
 }
 
+// KeyStrategy composes the message key for a message addressed to node label/id.
+type KeyStrategy interface {
+	Key(label string, id int64) string
+}
+
+type KeyStrategyFunc func(label string, id int64) string
+
+func (p KeyStrategyFunc) Key(label string, id int64) string {
+	return p(label, id)
+}
+
+var (
+	// NodeAffineKeys keeps all messages of a node on one partition, in order.
+	NodeAffineKeys = KeyStrategyFunc(func(label string, id int64) string {
+		return fmt.Sprintf("%s-%d", label, id)
+	})
+	// RandomKeys spreads messages of a node over all partitions.
+	RandomKeys = KeyStrategyFunc(func(label string, id int64) string {
+		return fmt.Sprintf("%s-%d-%s", label, id, RandStringBytes(4))
+	})
+)
+
+var (
+	keyStrategy   KeyStrategy = NodeAffineKeys
+	keyStrategyMu sync.RWMutex
+)
+
+// SetKeyStrategy replaces the global strategy used by ComposeKey and by all dispatchers
+// started without one, see ContextWithKeyStrategy. It must be called before any processor
+// is started, otherwise messages of a node may be keyed by both strategies.
+func SetKeyStrategy(strategy KeyStrategy) {
+	keyStrategyMu.Lock()
+	defer keyStrategyMu.Unlock()
+	keyStrategy = strategy
+}
+
+func globalKeyStrategy() KeyStrategy {
+	keyStrategyMu.RLock()
+	defer keyStrategyMu.RUnlock()
+	return keyStrategy
+}
+
 func ComposeKey(label string, id int64) string {
-	return fmt.Sprintf("%s-%d-%s", label, id, RandStringBytes(4))
+	return globalKeyStrategy().Key(label, id)
+}
+
+type keyStrategyKey struct{}
+
+// ContextWithKeyStrategy returns a copy of ctx, which lets the DispatcherFuncs
+// started with it compose their message keys with strategy.
+func ContextWithKeyStrategy(ctx context.Context, strategy KeyStrategy) context.Context {
+	return context.WithValue(ctx, keyStrategyKey{}, strategy)
+}
+
+// KeyStrategyFromContext returns the KeyStrategy of ctx or the global one.
+func KeyStrategyFromContext(ctx context.Context) KeyStrategy {
+	if strategy, ok := ctx.Value(keyStrategyKey{}).(KeyStrategy); ok {
+		return strategy
+	}
+	return globalKeyStrategy()
 }
 
 const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -0,0 +1,41 @@
+package shared
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyStrategy(t *testing.T) {
+	assert.Equal(t, "Person-1004", NodeAffineKeys.Key("Person", 1004), "node affine")
+	assert.Equal(t, NodeAffineKeys.Key("Person", 1004), NodeAffineKeys.Key("Person", 1004), "stable")
+
+	key := RandomKeys.Key("Person", 1004)
+	assert.Regexp(t, regexp.MustCompile(`^Person-1004-[a-zA-Z]{4}$`), key, "random suffix")
+
+	keys := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		keys[RandomKeys.Key("Person", 1004)] = true
+	}
+	assert.True(t, len(keys) > 1, "spread over keys")
+
+	defer SetKeyStrategy(NodeAffineKeys)
+	assert.Equal(t, "Person-1004", ComposeKey("Person", 1004), "default strategy")
+
+	SetKeyStrategy(KeyStrategyFunc(func(label string, id int64) string {
+		return label
+	}))
+	assert.Equal(t, "Person", ComposeKey("Person", 1004), "custom strategy")
+
+	assert.Equal(t, "Person", KeyStrategyFromContext(context.Background()).Key("Person", 1004), "global strategy")
+
+	ctx := ContextWithKeyStrategy(context.Background(), NodeAffineKeys)
+	assert.Equal(t, "Person-1004", KeyStrategyFromContext(ctx).Key("Person", 1004), "context strategy")
+
+	hCtx := HandlerContext{}
+	assert.Equal(t, "Person", hCtx.ComposeKey("Person", 1004), "handler without strategy")
+	hCtx.KeyStrategy = NodeAffineKeys
+	assert.Equal(t, "Person-1004", hCtx.ComposeKey("Person", 1004), "handler strategy")
+}
@@ -0,0 +1,197 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/juju/errors"
+	"github.com/lovoo/goka/kafka"
+)
+
+// TopicManagerFactory builds the goka TopicManagerBuilder a DispatcherFunc uses
+// for its processors and emitters. zServers may be empty.
+type TopicManagerFactory func(zServers []string) kafka.TopicManagerBuilder
+
+var (
+	// ZookeeperTopicManager checks and creates topics through ZooKeeper.
+	ZookeeperTopicManager TopicManagerFactory = func(zServers []string) kafka.TopicManagerBuilder {
+		return func(brokers []string) (kafka.TopicManager, error) {
+			if len(zServers) == 0 {
+				return nil, errors.New("zookeeper topic manager: no zookeeper servers defined")
+			}
+			return kafka.NewTopicManager(zServers, kafka.NewTopicManagerConfig())
+		}
+	}
+
+	// KafkaAdminTopicManager checks and creates topics through the Kafka admin API.
+	KafkaAdminTopicManager TopicManagerFactory = func(zServers []string) kafka.TopicManagerBuilder {
+		return AdminTopicManagerBuilder(NewAdminTopicManagerConfig())
+	}
+
+	// ExistingTopicManager assumes all topics exist and only validates their partition count.
+	ExistingTopicManager TopicManagerFactory = func(zServers []string) kafka.TopicManagerBuilder {
+		return kafka.DefaultTopicManagerBuilder
+	}
+)
+
+type topicManagerKey struct{}
+
+// ContextWithTopicManager returns a copy of ctx, which lets the DispatcherFuncs
+// started with it manage their topics by factory.
+func ContextWithTopicManager(ctx context.Context, factory TopicManagerFactory) context.Context {
+	return context.WithValue(ctx, topicManagerKey{}, factory)
+}
+
+// TopicManagerBuilder returns the TopicManagerBuilder chosen for ctx. Without a choice
+// topics are managed through ZooKeeper if zServers are given, otherwise through the Kafka admin API.
+func TopicManagerBuilder(ctx context.Context, zServers []string) kafka.TopicManagerBuilder {
+	if factory, ok := ctx.Value(topicManagerKey{}).(TopicManagerFactory); ok {
+		return factory(zServers)
+	}
+
+	if len(zServers) > 0 {
+		return ZookeeperTopicManager(zServers)
+	}
+
+	return KafkaAdminTopicManager(zServers)
+}
+
+// AdminTopicManagerConfig configures topics created by the Kafka admin API.
+type AdminTopicManagerConfig struct {
+	Sarama *sarama.Config
+	Table  struct {
+		Replication int
+	}
+	Stream struct {
+		Replication int
+		Retention   time.Duration
+	}
+}
+
+// NewAdminTopicManagerConfig returns the defaults of goka's ZooKeeper topic manager.
+func NewAdminTopicManagerConfig() *AdminTopicManagerConfig {
+	cfg := AdminTopicManagerConfig{
+		Sarama: sarama.NewConfig(),
+	}
+
+	// topic creation needs at least kafka 0.10.1
+	cfg.Sarama.Version = sarama.V1_0_0_0
+	cfg.Table.Replication = 2
+	cfg.Stream.Replication = 2
+	cfg.Stream.Retention = 1 * time.Hour
+	return &cfg
+}
+
+// AdminTopicManagerBuilder returns a TopicManagerBuilder using the Kafka admin API.
+func AdminTopicManagerBuilder(config *AdminTopicManagerConfig) kafka.TopicManagerBuilder {
+	return func(brokers []string) (kafka.TopicManager, error) {
+		return NewAdminTopicManager(brokers, config)
+	}
+}
+
+type adminTopicManager struct {
+	client sarama.Client
+	admin  sarama.ClusterAdmin
+	config *AdminTopicManagerConfig
+}
+
+// NewAdminTopicManager returns a kafka.TopicManager creating missing topics
+// through the Kafka admin API, which needs no ZooKeeper.
+func NewAdminTopicManager(brokers []string, config *AdminTopicManagerConfig) (kafka.TopicManager, error) {
+	if config == nil {
+		config = NewAdminTopicManagerConfig()
+	}
+
+	client, err := sarama.NewClient(brokers, config.Sarama)
+	if err != nil {
+		return nil, errors.Annotate(err, "NewClient")
+	}
+
+	admin, err := sarama.NewClusterAdmin(brokers, config.Sarama)
+	if err != nil {
+		client.Close()
+		return nil, errors.Annotate(err, "NewClusterAdmin")
+	}
+
+	tm := adminTopicManager{
+		client: client,
+		admin:  admin,
+		config: config,
+	}
+
+	return &tm, nil
+}
+
+func (p *adminTopicManager) Close() error {
+	if err := p.admin.Close(); err != nil {
+		p.client.Close()
+		return errors.Annotate(err, "Close [admin]")
+	}
+
+	return errors.Annotate(p.client.Close(), "Close [client]")
+}
+
+func (p *adminTopicManager) Partitions(topic string) ([]int32, error) {
+	return p.client.Partitions(topic)
+}
+
+func (p *adminTopicManager) EnsureTableExists(topic string, npar int) error {
+	return p.EnsureTopicExists(topic, npar, p.config.Table.Replication,
+		map[string]string{
+			"cleanup.policy": "compact",
+		})
+}
+
+func (p *adminTopicManager) EnsureStreamExists(topic string, npar int) error {
+	return p.EnsureTopicExists(topic, npar, p.config.Stream.Replication,
+		map[string]string{
+			"cleanup.policy": "delete",
+			"retention.ms":   fmt.Sprintf("%d", p.config.Stream.Retention/time.Millisecond),
+		})
+}
+
+func (p *adminTopicManager) EnsureTopicExists(topic string, npar, rfactor int, config map[string]string) error {
+	topics, err := p.admin.ListTopics()
+	if err != nil {
+		return errors.Annotate(err, "ListTopics")
+	}
+
+	if detail, ok := topics[topic]; ok {
+		return checkPartitionCount(topic, int(detail.NumPartitions), npar)
+	}
+
+	entries := make(map[string]*string, len(config))
+	for key, value := range config {
+		v := value
+		entries[key] = &v
+	}
+
+	err = p.admin.CreateTopic(topic, &sarama.TopicDetail{
+		NumPartitions:     int32(npar),
+		ReplicationFactor: int16(rfactor),
+		ConfigEntries:     entries,
+	}, false)
+
+	// another instance may have created the topic in the meantime
+	if err == sarama.ErrTopicAlreadyExists {
+		if err := p.client.RefreshMetadata(topic); err != nil {
+			return errors.Annotate(err, "RefreshMetadata")
+		}
+		par, err := p.client.Partitions(topic)
+		if err != nil {
+			return errors.Annotate(err, "Partitions")
+		}
+		return checkPartitionCount(topic, len(par), npar)
+	}
+
+	return errors.Annotatef(err, "CreateTopic [%s]", topic)
+}
+
+func checkPartitionCount(topic string, actual, expected int) error {
+	if actual != expected {
+		return errors.Errorf("topic %s has %d partitions instead of %d", topic, actual, expected)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package shared
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/juju/errors"
+	"github.com/lovoo/goka/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClient struct {
+	sarama.Client
+	partitions map[string]int
+	refreshed  []string
+	closed     bool
+}
+
+func (p *fakeClient) Partitions(topic string) ([]int32, error) {
+	return make([]int32, p.partitions[topic]), nil
+}
+
+func (p *fakeClient) RefreshMetadata(topics ...string) error {
+	p.refreshed = append(p.refreshed, topics...)
+	return nil
+}
+
+func (p *fakeClient) Close() error {
+	p.closed = true
+	return nil
+}
+
+type fakeAdmin struct {
+	sarama.ClusterAdmin
+	topics  map[string]sarama.TopicDetail
+	created map[string]*sarama.TopicDetail
+	// createErr is returned by CreateTopic instead of creating the topic
+	createErr error
+	closeErr  error
+}
+
+func (p *fakeAdmin) ListTopics() (map[string]sarama.TopicDetail, error) {
+	return p.topics, nil
+}
+
+func (p *fakeAdmin) CreateTopic(topic string, detail *sarama.TopicDetail, validateOnly bool) error {
+	if p.createErr != nil {
+		return p.createErr
+	}
+	p.created[topic] = detail
+	return nil
+}
+
+func (p *fakeAdmin) Close() error {
+	return p.closeErr
+}
+
+func newFakeAdminTopicManager() (*adminTopicManager, *fakeClient, *fakeAdmin) {
+	client := &fakeClient{partitions: map[string]int{}}
+	admin := &fakeAdmin{
+		topics:  map[string]sarama.TopicDetail{"Hub": {NumPartitions: 10}},
+		created: map[string]*sarama.TopicDetail{},
+	}
+	tm := &adminTopicManager{
+		client: client,
+		admin:  admin,
+		config: NewAdminTopicManagerConfig(),
+	}
+	return tm, client, admin
+}
+
+func TestAdminTopicManager(t *testing.T) {
+	tm, client, admin := newFakeAdminTopicManager()
+
+	assert.NoError(t, tm.EnsureStreamExists("Hub", 10), "existing topic")
+	assert.EqualError(t, tm.EnsureStreamExists("Hub", 5), "topic Hub has 10 partitions instead of 5")
+
+	assert.NoError(t, tm.EnsureStreamExists("Input2Person", 10))
+	if detail := admin.created["Input2Person"]; assert.NotNil(t, detail, "created stream") {
+		assert.Equal(t, int32(10), detail.NumPartitions)
+		assert.Equal(t, int16(2), detail.ReplicationFactor)
+		assert.Equal(t, "delete", *detail.ConfigEntries["cleanup.policy"])
+		assert.Equal(t, "3600000", *detail.ConfigEntries["retention.ms"])
+	}
+
+	assert.NoError(t, tm.EnsureTableExists("Transaction-table", 10))
+	if detail := admin.created["Transaction-table"]; assert.NotNil(t, detail, "created table") {
+		assert.Equal(t, "compact", *detail.ConfigEntries["cleanup.policy"])
+		assert.NotContains(t, detail.ConfigEntries, "retention.ms")
+	}
+
+	// created by another instance in the meantime
+	admin.createErr = sarama.ErrTopicAlreadyExists
+	client.partitions["Hub2Person"] = 3
+	assert.EqualError(t, tm.EnsureTopicExists("Hub2Person", 10, 2, nil), "topic Hub2Person has 3 partitions instead of 10")
+	assert.Equal(t, []string{"Hub2Person"}, client.refreshed, "refreshed metadata")
+
+	admin.createErr = sarama.ErrInvalidReplicationFactor
+	err := tm.EnsureTopicExists("DLQPerson", 10, 5, nil)
+	assert.Contains(t, err.Error(), "CreateTopic [DLQPerson]")
+
+	par, err := tm.Partitions("Hub2Person")
+	assert.NoError(t, err)
+	assert.Len(t, par, 3)
+
+	assert.NoError(t, tm.Close())
+	assert.True(t, client.closed, "client closed")
+
+	tm, client, admin = newFakeAdminTopicManager()
+	admin.closeErr = errors.New("broken")
+	assert.EqualError(t, tm.Close(), "Close [admin]: broken")
+	assert.True(t, client.closed, "client closed after admin failed")
+}
+
+func builderPointer(b kafka.TopicManagerBuilder) uintptr {
+	return reflect.ValueOf(b).Pointer()
+}
+
+func TestTopicManagerBuilder(t *testing.T) {
+	zServers := []string{"zk:2181"}
+	ctx := context.Background()
+
+	assert.Equal(t, builderPointer(ZookeeperTopicManager(zServers)),
+		builderPointer(TopicManagerBuilder(ctx, zServers)), "zookeeper with servers")
+	assert.Equal(t, builderPointer(KafkaAdminTopicManager(nil)),
+		builderPointer(TopicManagerBuilder(ctx, nil)), "admin api without servers")
+
+	var got []string
+	ctx = ContextWithTopicManager(ctx, func(z []string) kafka.TopicManagerBuilder {
+		got = z
+		return ExistingTopicManager(z)
+	})
+	assert.Equal(t, builderPointer(kafka.DefaultTopicManagerBuilder),
+		builderPointer(TopicManagerBuilder(ctx, zServers)), "chosen factory")
+	assert.Equal(t, zServers, got, "servers passed to the factory")
+
+	_, err := ZookeeperTopicManager(nil)([]string{"kafka:9092"})
+	assert.EqualError(t, err, "zookeeper topic manager: no zookeeper servers defined")
+
+	cfg := NewAdminTopicManagerConfig()
+	assert.Equal(t, sarama.V1_0_0_0, cfg.Sarama.Version)
+	assert.Equal(t, time.Hour, cfg.Stream.Retention)
+}
@@ -0,0 +1,196 @@
+package shared
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/kafka"
+)
+
+// TopicSpec defines how the topics of an EntityDescriptor are created.
+type TopicSpec struct {
+	Partitions  int
+	Replication int
+	// Retention of stream topics, 0 keeps the broker default.
+	Retention time.Duration
+	// Config holds additional topic configuration entries.
+	Config map[string]string
+}
+
+var (
+	DefaultTopicSpec = TopicSpec{
+		Partitions:  10,
+		Replication: 2,
+	}
+)
+
+func (p TopicSpec) config(table bool) map[string]string {
+	cfg := map[string]string{}
+	for key, value := range p.Config {
+		cfg[key] = value
+	}
+
+	if table {
+		cfg["cleanup.policy"] = "compact"
+	} else if p.Retention > 0 {
+		cfg["retention.ms"] = fmt.Sprintf("%d", p.Retention/time.Millisecond)
+	}
+
+	return cfg
+}
+
+// Topic is a kafka topic to be provisioned.
+type Topic struct {
+	Name  string
+	Table bool
+	Spec  TopicSpec
+}
+
+// HubTopicSpec returns the most partitions and replicas of the specs of descrs, the
+// default spec for the hub stream shared by all descriptors.
+func HubTopicSpec(descrs ...EntityDescriptor) TopicSpec {
+	if len(descrs) == 0 {
+		return DefaultTopicSpec
+	}
+
+	spec := TopicSpec{}
+	for _, descr := range descrs {
+		s := descr.TopicSpec()
+		if s.Partitions > spec.Partitions {
+			spec.Partitions = s.Partitions
+		}
+		if s.Replication > spec.Replication {
+			spec.Replication = s.Replication
+		}
+	}
+	return spec
+}
+
+// DescriptorTopics returns the topics implied by descrs: their input streams and, if
+// failures are routed, their retry and dead letter streams and the group topics of the
+// retry consumer, all with the spec of their descriptor. Their output streams, like the
+// shared hub stream, are provisioned with hubSpec. Descriptors demanding different specs
+// for a topic they own are an error.
+func DescriptorTopics(hubSpec TopicSpec, descrs ...EntityDescriptor) ([]Topic, error) {
+	topics := map[string]Topic{}
+	add := func(t Topic) error {
+		if cur, ok := topics[t.Name]; ok {
+			if !reflect.DeepEqual(cur.Spec, t.Spec) {
+				return errors.Errorf("conflicting specs for topic %s: %+v, %+v", t.Name, cur.Spec, t.Spec)
+			}
+			return nil
+		}
+
+		topics[t.Name] = t
+		return nil
+	}
+
+	for _, descr := range descrs {
+		spec := descr.TopicSpec()
+		owned := []Topic{
+			{Name: string(descr.EventInputStream()), Spec: spec},
+			{Name: string(descr.HubInputStream()), Spec: spec},
+		}
+
+		if RoutesFailures(descr) {
+			owned = append(owned,
+				Topic{Name: string(descr.RetryStream()), Spec: spec},
+				Topic{Name: string(descr.DeadLetterStream()), Spec: spec},
+			)
+			owned = append(owned, GroupTopics(descr.RetryGroup(), spec)...)
+		}
+
+		for _, t := range owned {
+			if err := add(t); err != nil {
+				return nil, errors.Annotatef(err, "descriptor %s", descr.Label())
+			}
+		}
+	}
+
+	for _, descr := range descrs {
+		for _, stream := range []goka.Stream{descr.EventOutputStream(), descr.HubOutputStream()} {
+			if _, ok := topics[string(stream)]; !ok {
+				topics[string(stream)] = Topic{Name: string(stream), Spec: hubSpec}
+			}
+		}
+	}
+
+	res := make([]Topic, 0, len(topics))
+	for _, t := range topics {
+		res = append(res, t)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+
+	return res, nil
+}
+
+// GroupTopics returns the group table and loop stream of group, needed by processors
+// persisting state like the tx consumer. DescriptorTopics includes those of the retry
+// consumers.
+func GroupTopics(group goka.Group, spec TopicSpec) []Topic {
+	return []Topic{
+		{Name: string(goka.GroupTable(group)), Table: true, Spec: spec},
+		// goka does not export the name of the loop stream
+		{Name: string(group) + "-loop", Spec: spec},
+	}
+}
+
+// ProvisionErrors collects the topics failing provisioning.
+type ProvisionErrors map[string]error
+
+func (p ProvisionErrors) Error() string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, 0, len(p))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", name, p[name]))
+	}
+
+	return "provision topics: " + strings.Join(msgs, "; ")
+}
+
+// ProvisionTopics creates the missing topics and checks the partition count
+// of the existing ones. Topic managers unable to create topics, like
+// ExistingTopicManager, report missing topics as errors.
+func ProvisionTopics(tm kafka.TopicManager, topics ...Topic) error {
+	errs := ProvisionErrors{}
+	for _, t := range topics {
+		if err := provisionTopic(tm, t); err != nil {
+			errs[t.Name] = err
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func provisionTopic(tm kafka.TopicManager, t Topic) error {
+	par, err := tm.Partitions(t.Name)
+	if err == nil && len(par) > 0 {
+		return checkPartitionCount(t.Name, len(par), t.Spec.Partitions)
+	}
+
+	log.Infof("create topic %s with %d partitions", t.Name, t.Spec.Partitions)
+	if err := tm.EnsureTopicExists(t.Name, t.Spec.Partitions,
+		t.Spec.Replication, t.Spec.config(t.Table),
+	); err != nil {
+		return errors.Annotate(err, "EnsureTopicExists")
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package shared
+
+import (
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTopicManager struct {
+	partitions map[string]int
+	created    map[string]map[string]string
+}
+
+func (p *fakeTopicManager) EnsureTableExists(topic string, npar int) error {
+	return errors.New("not supported")
+}
+
+func (p *fakeTopicManager) EnsureStreamExists(topic string, npar int) error {
+	return errors.New("not supported")
+}
+
+func (p *fakeTopicManager) EnsureTopicExists(topic string, npar, rfactor int, config map[string]string) error {
+	p.partitions[topic] = npar
+	p.created[topic] = config
+	return nil
+}
+
+func (p *fakeTopicManager) Partitions(topic string) ([]int32, error) {
+	return make([]int32, p.partitions[topic]), nil
+}
+
+func (p *fakeTopicManager) Close() error {
+	return nil
+}
+
+type testDescriptor struct {
+	*BaseDescriptor
+}
+
+func (p *testDescriptor) ContextDef() ContextDefinition {
+	return ContextDefinition{}
+}
+
+func topicNames(topics []Topic) []string {
+	names := []string{}
+	for _, topic := range topics {
+		names = append(names, topic.Name)
+	}
+	return names
+}
+
+func TestProvisionTopics(t *testing.T) {
+	person := &testDescriptor{NewBaseDescriptor("Person")}
+	person.SetRetryPolicy(DefaultRetryPolicy())
+	photo := &testDescriptor{NewBaseDescriptor("Photo")}
+
+	topics, err := DescriptorTopics(HubTopicSpec(person, photo), person, photo)
+	assert.NoError(t, err, "descriptor topics")
+	assert.Equal(t, []string{
+		"DLQPerson", "Hub", "Hub2Person", "Hub2Photo", "Input2Person",
+		"Input2Photo", "Person_Retry-loop", "Person_Retry-table", "RetryPerson",
+	}, topicNames(topics), "topic names")
+
+	tm := &fakeTopicManager{
+		partitions: map[string]int{"Hub": 10, "Input2Photo": 3},
+		created:    map[string]map[string]string{},
+	}
+
+	err = ProvisionTopics(tm, topics...)
+	if assert.IsType(t, ProvisionErrors{}, err, "partition drift") {
+		errs := err.(ProvisionErrors)
+		assert.Len(t, errs, 1, "provision errors")
+		assert.Contains(t, errs, "Input2Photo", "drifted topic")
+	}
+
+	assert.Len(t, tm.created, 7, "created topics")
+	assert.NotContains(t, tm.created, "Hub", "existing topic")
+	assert.Equal(t, "compact", tm.created["Person_Retry-table"]["cleanup.policy"], "table cleanup policy")
+
+	table := GroupTopics("Transaction", DefaultTopicSpec)[0]
+	assert.NoError(t, ProvisionTopics(tm, table), "provision table")
+	assert.Equal(t, "compact", tm.created["Transaction-table"]["cleanup.policy"], "table cleanup policy")
+}
+
+func TestDescriptorTopicSpecs(t *testing.T) {
+	person := &testDescriptor{NewBaseDescriptor("Person")}
+	photo := &testDescriptor{NewBaseDescriptor("Photo")}
+	photo.SetTopicSpec(TopicSpec{Partitions: 20, Replication: 1, Retention: time.Hour})
+
+	hubSpec := HubTopicSpec(person, photo)
+	assert.Equal(t, TopicSpec{Partitions: 20, Replication: 2}, hubSpec, "most partitions and replicas")
+	assert.Equal(t, DefaultTopicSpec, HubTopicSpec())
+
+	topics, err := DescriptorTopics(hubSpec, person, photo)
+	if !assert.NoError(t, err, "different descriptor specs") {
+		return
+	}
+
+	specs := map[string]TopicSpec{}
+	for _, topic := range topics {
+		specs[topic.Name] = topic.Spec
+	}
+	assert.Equal(t, hubSpec, specs["Hub"], "hub spec")
+	assert.Equal(t, DefaultTopicSpec, specs["Input2Person"], "person spec")
+	assert.Equal(t, photo.TopicSpec(), specs["Hub2Photo"], "photo spec")
+
+	other := &testDescriptor{NewBaseDescriptor("Photo")}
+	_, err = DescriptorTopics(hubSpec, photo, other)
+	assert.Error(t, err, "conflicting specs of a topic owned by two descriptors")
+}
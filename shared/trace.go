@@ -0,0 +1,77 @@
+package shared
+
+import (
+	"fmt"
+	"strings"
+)
+
+type TraceKind string
+
+var (
+	TraceChain           = TraceKind("chain")
+	TraceSelector        = TraceKind("selector")
+	TraceWith            = TraceKind("with")
+	TraceOr              = TraceKind("or")
+	TraceAnd             = TraceKind("and")
+	TraceNot             = TraceKind("not")
+	TraceIgnoreOwnWrites = TraceKind("ignoreOwnWrites")
+)
+
+// Trace is the evaluation tree of a chain for a single message. Every node
+// records whether its selector, condition or branch evaluated true.
+// A nil *Trace records nothing, so evaluations trace only on demand.
+type Trace struct {
+	Kind     TraceKind `json:"kind"`
+	Name     string    `json:"name,omitempty"`
+	Result   bool      `json:"result"`
+	Children []*Trace  `json:"children,omitempty"`
+}
+
+func NewTrace(kind TraceKind, name string) *Trace {
+	return &Trace{Kind: kind, Name: name}
+}
+
+// Add appends a child node and returns it.
+func (p *Trace) Add(kind TraceKind, name string, result bool) *Trace {
+	if p == nil {
+		return nil
+	}
+
+	t := &Trace{Kind: kind, Name: name, Result: result}
+	p.Children = append(p.Children, t)
+	return t
+}
+
+// Set records the result of the node and returns it.
+func (p *Trace) Set(result bool) bool {
+	if p != nil {
+		p.Result = result
+	}
+	return result
+}
+
+func (p *Trace) write(b *strings.Builder, depth int) {
+	fmt.Fprintf(b, "%s%s", strings.Repeat("  ", depth), p.Kind)
+	if p.Name != "" {
+		fmt.Fprintf(b, " %s", p.Name)
+	}
+	fmt.Fprintf(b, ": %t\n", p.Result)
+
+	for _, child := range p.Children {
+		child.write(b, depth+1)
+	}
+}
+
+// String renders the trace as an indented tree, one node per line.
+func (p *Trace) String() string {
+	if p == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	p.write(&b, 0)
+	return b.String()
+}
+
+// TraceFunc receives the trace of each message evaluated by a traced chain.
+type TraceFunc func(trace *Trace)
@@ -0,0 +1,81 @@
+package shared
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// TransactionContext collects the events of a single Neo4j transaction.
+type TransactionContext struct {
+	TxID        int64           `json:"tx_id"`
+	EventsCount int             `json:"events_count"`
+	Events      []*EventContext `json:"events"`
+	TimedOut    bool            `json:"timed_out"`
+	Deadline    time.Time       `json:"deadline"` // zero if the transaction never times out
+}
+
+func NewTransactionContext(txID int64, eventsCount int) *TransactionContext {
+	ctx := TransactionContext{
+		TxID:        txID,
+		EventsCount: eventsCount,
+	}
+	return &ctx
+}
+
+// Add inserts evt ordered by TxEventID and returns false if the event was already collected.
+func (p *TransactionContext) Add(evt *EventContext) bool {
+	idx := sort.Search(len(p.Events), func(i int) bool {
+		return p.Events[i].TxEventID >= evt.TxEventID
+	})
+
+	if idx < len(p.Events) && p.Events[idx].TxEventID == evt.TxEventID {
+		return false
+	}
+
+	p.Events = append(p.Events, nil)
+	copy(p.Events[idx+1:], p.Events[idx:])
+	p.Events[idx] = evt
+	return true
+}
+
+func (p *TransactionContext) Complete() bool {
+	return len(p.Events) >= p.EventsCount
+}
+
+func (p *TransactionContext) Match(
+
+	complete bool,
+	timedOut bool,
+	conditions EvalFuncs,
+
+) bool {
+	matcher := NewMatcher(
+		func() (bool, EvalFunc) {
+			return complete,
+				func(_ interface{}) bool {
+					return p.Complete()
+				}
+		},
+		func() (bool, EvalFunc) {
+			return timedOut,
+				func(_ interface{}) bool {
+					return p.TimedOut
+				}
+		},
+		MatchConditions(conditions...),
+	)
+
+	return matcher.Eval(*p)
+}
+
+type TransactionContextCodec struct{}
+
+func (p *TransactionContextCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (p *TransactionContextCodec) Decode(data []byte) (interface{}, error) {
+	var m TransactionContext
+	return &m, json.Unmarshal(data, &m)
+}
@@ -0,0 +1,274 @@
+// Package testharness runs DispatcherFuncs against goka's in-memory tester,
+// which lets tests push messages through the processors without any brokers.
+package testharness
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/denkhaus/nksh/event"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/tester"
+)
+
+var (
+	// StartupTimeout limits the time Start waits for the processors to be defined.
+	StartupTimeout = 10 * time.Second
+)
+
+// registeringTester signals every group graph registered by a processor. Output streams
+// are registered by registerOutputs after all processors, so topics read by a processor
+// take the codec of the reader, e.g. the Hub stream, which event consumers write with
+// the EventContextCodec and the hub router reads with the HubContextCodec.
+type registeringTester struct {
+	*tester.Tester
+	registered chan struct{}
+	mu         sync.Mutex
+	topics     map[string]bool
+	outputs    []goka.Edge
+}
+
+func (p *registeringTester) RegisterGroupGraph(gg *goka.GroupGraph) {
+	edges := []goka.Edge{}
+	for _, input := range gg.InputStreams() {
+		edges = append(edges, input)
+	}
+	edges = append(edges, gg.JointTables()...)
+	edges = append(edges, gg.LookupTables()...)
+	if table := gg.GroupTable(); table != nil {
+		edges = append(edges, table)
+	}
+	if loop := gg.LoopStream(); loop != nil {
+		edges = append(edges, loop)
+	}
+
+	p.mu.Lock()
+	for _, edge := range edges {
+		p.topics[edge.Topic()] = true
+	}
+	p.outputs = append(p.outputs, gg.OutputStreams()...)
+	p.mu.Unlock()
+
+	p.Tester.RegisterGroupGraph(goka.DefineGroup(gg.Group(), edges...))
+	p.registered <- struct{}{}
+}
+
+// registerOutputs registers the output streams no processor reads.
+func (p *registeringTester) registerOutputs() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	edges := []goka.Edge{}
+	for _, output := range p.outputs {
+		if !p.topics[output.Topic()] {
+			p.topics[output.Topic()] = true
+			edges = append(edges, output)
+		}
+	}
+	p.outputs = nil
+
+	if len(edges) > 0 {
+		p.Tester.RegisterGroupGraph(goka.DefineGroup("testharness", edges...))
+	}
+}
+
+// processors counts the processors registered by the DispatcherFuncs.
+type processors struct {
+	mu    sync.Mutex
+	count int
+}
+
+func (p *processors) RegisterProcessor(name string) shared.ProcessorHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.count++
+	return p
+}
+
+func (p *processors) Started(recovered func() bool) {}
+func (p *processors) Stopped(err error)             {}
+
+type Option func(p *Harness)
+
+// WithGraphClient sets the GraphClient used by the chains of all consumers,
+// usually a graphtest.Client.
+func WithGraphClient(client shared.GraphClient) Option {
+	return func(p *Harness) {
+		p.graphClient = client
+	}
+}
+
+// WithMetrics sets the Metrics all DispatcherFuncs report to.
+func WithMetrics(metrics shared.Metrics) Option {
+	return func(p *Harness) {
+		p.metrics = metrics
+	}
+}
+
+// Harness runs DispatcherFuncs with the processors and emitters wired to a goka tester.
+type Harness struct {
+	tester      *registeringTester
+	graphClient shared.GraphClient
+	metrics     shared.Metrics
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	mu          sync.Mutex
+	err         error
+}
+
+func New(t tester.T, opts ...Option) *Harness {
+	h := Harness{
+		tester: &registeringTester{
+			Tester:     tester.New(t),
+			registered: make(chan struct{}),
+			topics:     make(map[string]bool),
+		},
+	}
+
+	for _, opt := range opts {
+		opt(&h)
+	}
+
+	return &h
+}
+
+// Tester returns the underlying goka tester.
+func (p *Harness) Tester() *tester.Tester {
+	return p.tester.Tester
+}
+
+func (p *Harness) setError(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// Start runs funcs and returns after each of them defined the processors it registered.
+func (p *Harness) Start(funcs ...shared.DispatcherFunc) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	procs := &processors{}
+	ctx = shared.ContextWithHealth(ctx, procs)
+	ctx = shared.ContextWithProcessorOptions(ctx, goka.WithTester(p.tester))
+	ctx = shared.ContextWithEmitterOptions(ctx, goka.WithEmitterTester(p.tester))
+	if p.graphClient != nil {
+		ctx = shared.ContextWithGraphClient(ctx, p.graphClient)
+	}
+	if p.metrics != nil {
+		ctx = shared.ContextWithMetrics(ctx, p.metrics)
+	}
+
+	runs := make([]func() error, 0, len(funcs))
+	for _, fn := range funcs {
+		runs = append(runs, fn(ctx, nil, nil))
+	}
+
+	failed := make(chan error, len(runs))
+	for _, run := range runs {
+		run := run
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			if err := run(); err != nil {
+				p.setError(err)
+				failed <- err
+			}
+		}()
+	}
+
+	timeout := time.After(StartupTimeout)
+	for i := 0; i < procs.count; i++ {
+		select {
+		case <-p.tester.registered:
+		case err := <-failed:
+			return errors.Annotate(err, "run")
+		case <-timeout:
+			return errors.New("timeout waiting for processors")
+		}
+	}
+
+	p.tester.registerOutputs()
+	return nil
+}
+
+// Stop stops all processors and returns the first error of the DispatcherFuncs.
+func (p *Harness) Stop() error {
+	if p.cancel != nil {
+		p.cancel()
+	}
+
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// Consume pushes msg to stream and returns after all processors handled
+// it and the messages emitted in turn.
+func (p *Harness) Consume(stream goka.Stream, key string, msg interface{}) {
+	p.tester.Consume(string(stream), key, msg)
+}
+
+// ConsumeNeo4jMessage pushes the raw neo4j streams message data to stream,
+// keyed by its payload id like the neo4j streams plugin does.
+func (p *Harness) ConsumeNeo4jMessage(stream goka.Stream, data string) {
+	key := ""
+	if m, err := new(event.Neo4jMessageCodec).Decode([]byte(data)); err == nil {
+		key = m.(*event.Neo4jMessage).Payload.ID
+	}
+
+	p.tester.ConsumeData(string(stream), key, []byte(data))
+}
+
+// Track returns a Tracker of the messages emitted to stream from now on.
+func (p *Harness) Track(stream goka.Stream) *Tracker {
+	return &Tracker{p.tester.NewQueueTracker(string(stream))}
+}
+
+// Tracker collects the messages emitted to a stream.
+type Tracker struct {
+	*tester.QueueTracker
+}
+
+// Messages returns the decoded messages emitted since the last call.
+func (p *Tracker) Messages() []interface{} {
+	res := []interface{}{}
+	for {
+		_, value, ok := p.Next()
+		if !ok {
+			return res
+		}
+		res = append(res, value)
+	}
+}
+
+// HubContexts returns the HubContexts emitted since the last call.
+func (p *Tracker) HubContexts() []*shared.HubContext {
+	res := []*shared.HubContext{}
+	for _, m := range p.Messages() {
+		if hubCtx, ok := m.(*shared.HubContext); ok {
+			res = append(res, hubCtx)
+		}
+	}
+
+	return res
+}
+
+// EventContexts returns the EventContexts emitted since the last call.
+func (p *Tracker) EventContexts() []*shared.EventContext {
+	res := []*shared.EventContext{}
+	for _, m := range p.Messages() {
+		if eventCtx, ok := m.(*shared.EventContext); ok {
+			res = append(res, eventCtx)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,127 @@
+package testharness
+
+import (
+	"testing"
+
+	"github.com/denkhaus/nksh/event"
+	"github.com/denkhaus/nksh/graphtest"
+	"github.com/denkhaus/nksh/hub"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/lovoo/goka"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = `
+{
+	"meta": {
+	  "timestamp": 1532597182604,
+	  "username": "neo4j",
+	  "tx_id": 3,
+	  "tx_event_id": 0,
+	  "tx_events_count": 1,
+	  "operation": "updated",
+	  "source": {
+		"hostname": "neo4j.mycompany.com"
+	  }
+	},
+	"payload": {
+	  "id": "1004",
+	  "type": "node",
+	  "before": {
+		"labels": ["Person"],
+		"properties": {
+		  "first_name": "Anne"
+		}
+	  },
+	  "after": {
+		"labels": ["Person"],
+		"properties": {
+		  "first_name": "Anne Marie"
+		}
+	  }
+	}
+  }
+`
+
+func TestHarness(t *testing.T) {
+	client := graphtest.NewClient()
+	client.OnQuery("MATCH (super)-[]->(p)").Return(
+		graphtest.NewRecord(map[string]interface{}{
+			"id":     int64(7),
+			"labels": []interface{}{"PersonConnector"},
+		}),
+	)
+
+	person := graphtest.NewDescriptor("Person")
+	connector := graphtest.NewDescriptor("PersonConnector")
+
+	received := []*shared.HubContext{}
+	h := New(t, WithGraphClient(client))
+	err := h.Start(
+		event.CreateTranslatorDefaults("neo4j", person, connector),
+		event.CreateConsumerDefaults(person,
+			event.If(event.OnFieldUpdated("first_name")).
+				Then(event.NotifySuperOrdinates()).
+				Catch(func(err error) { t.Error(err) }),
+		),
+		hub.CreateRouterDefaults(person, connector),
+		hub.CreateConsumerDefaults(connector,
+			hub.If(hub.OnNodeUpdated()).
+				Then(func(ctx *shared.HandlerContext) error {
+					received = append(received, ctx.HubContext)
+					return nil
+				}).
+				Catch(func(err error) { t.Error(err) }),
+		),
+	)
+	assert.NoError(t, err, "start harness")
+
+	hubMessages := h.Track(shared.HubStream)
+	h.ConsumeNeo4jMessage(goka.Stream("neo4j"), update)
+
+	msgs := hubMessages.HubContexts()
+	if assert.Len(t, msgs, 1, "hub messages") {
+		assert.Equal(t, "Person", msgs[0].Sender, "sender")
+		assert.Equal(t, "PersonConnector", msgs[0].Receiver, "receiver")
+		assert.Equal(t, int64(1004), msgs[0].SenderID, "sender id")
+	}
+
+	if assert.Len(t, received, 1, "received hub messages") {
+		assert.Equal(t, int64(7), received[0].ReceiverID, "receiver id")
+	}
+
+	client.AssertExecuted(t, "MATCH (super)-[]->(p)", map[string]interface{}{
+		"id": int64(1004),
+	})
+
+	assert.NoError(t, h.Stop(), "stop harness")
+}
+
+func TestHarnessChainSetSwap(t *testing.T) {
+	person := graphtest.NewDescriptor("Person")
+	handled := []string{}
+	handler := func(name string) event.Executable {
+		return event.If(event.OnFieldUpdated("first_name")).
+			Then(func(ctx *shared.HandlerContext) error {
+				handled = append(handled, name+":"+ctx.Chain)
+				return nil
+			}).
+			Catch(func(err error) { t.Error(err) }).
+			Named(name)
+	}
+
+	set := event.NewChainSet(handler("first"))
+	h := New(t)
+	err := h.Start(
+		event.CreateTranslatorDefaults("neo4j", person),
+		event.CreateChainSetConsumerDefaults(person, set),
+	)
+	assert.NoError(t, err, "start harness")
+
+	h.ConsumeNeo4jMessage(goka.Stream("neo4j"), update)
+	assert.Equal(t, int64(2), set.Store(handler("second"), handler("other").Scoped("Photo")))
+	h.ConsumeNeo4jMessage(goka.Stream("neo4j"), update)
+
+	assert.Equal(t, []string{"first:first", "second:second"}, handled)
+	assert.NoError(t, h.Stop(), "stop harness")
+}
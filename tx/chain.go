@@ -0,0 +1,256 @@
+package tx
+
+import (
+	"github.com/denkhaus/nksh/event"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/lann/builder"
+	"github.com/lovoo/goka"
+)
+
+// Requirement is satisfied by a transaction containing an event
+// for a node or relationship labeled Label that matches Event.
+type Requirement struct {
+	Label string
+	Event event.ActionData
+}
+
+func (p *Requirement) Match(m *shared.TransactionContext) bool {
+	for _, evt := range m.Events {
+		if p.Label != "" && p.Label != "*" && !evt.HasLabel(p.Label) {
+			continue
+		}
+		if p.Event.Match(evt) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type ActionData struct {
+	GraphClient   shared.GraphClient
+	Metrics       shared.Metrics
+	KeyStrategy   shared.KeyStrategy
+	Name          string
+	Complete      bool
+	TimedOut      bool
+	Contains      []Requirement
+	Conditions    shared.EvalFuncs
+	ErrorHandlers shared.ErrorHandlers
+	Transactional bool
+	Then          shared.Handlers
+	Else          shared.Handlers
+	Or            []ActionData
+	And           []ActionData
+	Not           []ActionData
+}
+
+func (p *ActionData) Match(m *shared.TransactionContext) bool {
+	result := m.Match(
+		p.Complete,
+		p.TimedOut,
+		p.Conditions,
+	)
+	for _, req := range p.Contains {
+		result = result && req.Match(m)
+	}
+	for _, data := range p.Or {
+		result = result || data.Match(m)
+	}
+	for _, data := range p.And {
+		result = result && data.Match(m)
+	}
+	for _, data := range p.Not {
+		result = result && !data.Match(m)
+	}
+	return result
+}
+
+type Selectable interface {
+	Contains(label string, comb event.Combinable) Combinable
+	OnComplete() Combinable
+	OnTimeout() Combinable
+	With(fn shared.EvalFunc) Combinable
+}
+
+type Combinable interface {
+	Or(or ...Combinable) Combinable
+	And(or ...Combinable) Combinable
+	Not(not ...Combinable) Combinable
+}
+
+type Catchable interface {
+	Catch(fn shared.ErrorHandler) Executable
+}
+
+type Executable interface {
+	Transactional() Executable
+	Execute(ctx goka.Context, m *shared.TransactionContext) shared.ChainHandledState
+	SetGraphClient(client shared.GraphClient) Executable
+	Named(name string) Executable
+	Name() string
+}
+
+type Proceedable interface {
+	Then(fns ...shared.Handler) Alternative
+}
+
+type Alternative interface {
+	Else(fns ...shared.Handler) Catchable
+	Catch(fn shared.ErrorHandler) Executable
+}
+
+type chain builder.Builder
+
+func (b chain) Contains(label string, comb event.Combinable) Combinable {
+	req := Requirement{
+		Label: label,
+		Event: builder.GetStruct(comb).(event.ActionData),
+	}
+	return builder.Append(b, "Contains", req).(Combinable)
+}
+
+func (b chain) OnComplete() Combinable {
+	return builder.Set(b, "Complete", true).(Combinable)
+}
+
+func (b chain) OnTimeout() Combinable {
+	return builder.Set(b, "TimedOut", true).(Combinable)
+}
+
+func (b chain) With(fn shared.EvalFunc) Combinable {
+	return builder.Append(b, "Conditions", fn).(Combinable)
+}
+
+func (b chain) Or(or ...Combinable) Combinable {
+	data := []interface{}{}
+	for _, o := range or {
+		data = append(data, builder.GetStruct(o))
+	}
+	return builder.Append(b, "Or", data...).(Combinable)
+}
+
+func (b chain) And(and ...Combinable) Combinable {
+	data := []interface{}{}
+	for _, a := range and {
+		data = append(data, builder.GetStruct(a))
+	}
+	return builder.Append(b, "And", data...).(Combinable)
+}
+
+func (b chain) Not(not ...Combinable) Combinable {
+	data := []interface{}{}
+	for _, n := range not {
+		data = append(data, builder.GetStruct(n))
+	}
+	return builder.Append(b, "Not", data...).(Combinable)
+}
+
+// Transactional runs the handlers of the chain in a single Neo4j transaction.
+func (b chain) Transactional() Executable {
+	return builder.Set(b, "Transactional", true).(Executable)
+}
+
+// SetGraphClient sets the GraphClient the handlers of the chain run their cypher with.
+func (b chain) SetGraphClient(client shared.GraphClient) Executable {
+	return builder.Set(b, "GraphClient", client).(Executable)
+}
+
+// Named names the chain in logs and metrics.
+func (b chain) Named(name string) Executable {
+	return builder.Set(b, "Name", name).(Executable)
+}
+
+func (b chain) Name() string {
+	if name, ok := builder.Get(b, "Name"); ok {
+		return name.(string)
+	}
+	return ""
+}
+
+func (b chain) Catch(fn shared.ErrorHandler) Executable {
+	return builder.Append(b, "ErrorHandlers", fn).(Executable)
+}
+
+func (b chain) Then(fns ...shared.Handler) Alternative {
+	data := []interface{}{}
+	for _, fn := range fns {
+		data = append(data, fn)
+	}
+	return builder.Append(b, "Then", data...).(Alternative)
+}
+
+func (b chain) Else(fns ...shared.Handler) Catchable {
+	data := []interface{}{}
+	for _, fn := range fns {
+		data = append(data, fn)
+	}
+	return builder.Append(b, "Else", data...).(Catchable)
+}
+
+func (b chain) handleError(err error) {
+	if ehs, ok := builder.Get(b, "ErrorHandlers"); ok {
+		handlers := ehs.(shared.ErrorHandlers)
+		for _, handle := range handlers {
+			handle(err)
+		}
+	} else {
+		panic(errors.Annotate(err, "TxChain: no catch handler found"))
+	}
+}
+
+func (b chain) Execute(ctx goka.Context, m *shared.TransactionContext) shared.ChainHandledState {
+	data := builder.GetStruct(b).(ActionData)
+	if len(data.Then) == 0 {
+		b.handleError(errors.New("TxChain: no handler defined"))
+		return shared.ChainHandledStateThenFailed
+	}
+
+	hCtx := shared.HandlerContext{
+		GokaContext:        ctx,
+		GraphClient:        data.GraphClient,
+		Metrics:            data.Metrics,
+		KeyStrategy:        data.KeyStrategy,
+		Chain:              data.Name,
+		TransactionContext: m,
+	}
+
+	if data.Match(m) {
+		if err := shared.ExecuteHandlers(&hCtx, data.Then, data.Transactional); err != nil {
+			b.handleError(errors.Annotate(err, "HandleEvent [then]"))
+			return shared.ChainHandledStateThenFailed
+		}
+
+		return shared.ChainHandledStateThen
+	}
+
+	if len(data.Else) == 0 {
+		return shared.ChainHandledStateUnhandled
+	}
+
+	if err := shared.ExecuteHandlers(&hCtx, data.Else, data.Transactional); err != nil {
+		b.handleError(errors.Annotate(err, "HandleEvent [else]"))
+		return shared.ChainHandledStateElseFailed
+	}
+
+	return shared.ChainHandledStateElse
+}
+
+var actionChain = builder.Register(chain{}, ActionData{})
+
+func If(comb Combinable) Proceedable {
+	return comb.(Proceedable)
+}
+func Contains(label string, comb event.Combinable) Combinable {
+	return actionChain.(Selectable).Contains(label, comb)
+}
+func OnComplete() Combinable {
+	return actionChain.(Selectable).OnComplete()
+}
+func OnTimeout() Combinable {
+	return actionChain.(Selectable).OnTimeout()
+}
+func With(fn shared.EvalFunc) Combinable {
+	return actionChain.(Selectable).With(fn)
+}
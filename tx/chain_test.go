@@ -0,0 +1,71 @@
+package tx
+
+import (
+	"testing"
+
+	"github.com/denkhaus/nksh/event"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChain(t *testing.T) {
+	txCtx := shared.NewTransactionContext(7, 2)
+	txCtx.Add(&shared.EventContext{
+		TxID:      7,
+		TxEventID: 1,
+		NodeID:    2336,
+		Operation: shared.CreatedOperation,
+		Relationship: &shared.RelationshipInfo{
+			Type:        "HAS_PHOTO",
+			StartLabels: []string{"Person"},
+			EndLabels:   []string{"Photo"},
+		},
+	})
+	assert.False(t, txCtx.Complete(), "complete")
+
+	txCtx.Add(&shared.EventContext{
+		TxID:      7,
+		TxEventID: 0,
+		NodeID:    1004,
+		Labels:    []string{"Person"},
+		Operation: shared.CreatedOperation,
+	})
+	assert.True(t, txCtx.Complete(), "complete")
+	assert.Equal(t, 0, txCtx.Events[0].TxEventID, "events ordered")
+
+	var handledError error
+	thenTriggered := 0
+	elseTriggered := 0
+
+	condition := If(
+		OnComplete().And(
+			Contains("Person", event.OnNodeCreated()),
+			Contains("Photo", event.OnRelationshipCreated("HAS_PHOTO")),
+		).Not(
+			Contains("*", event.OnNodeDeleted()),
+		),
+	).Then(func(_ *shared.HandlerContext) error {
+		thenTriggered++
+		return nil
+	}).Else(func(_ *shared.HandlerContext) error {
+		elseTriggered++
+		return nil
+	}).Catch(func(err error) {
+		handledError = err
+	})
+
+	state := condition.Execute(nil, txCtx)
+	assert.NoError(t, handledError, "handled error")
+	assert.Equal(t, 1, thenTriggered, "then triggered")
+	assert.Equal(t, 0, elseTriggered, "else triggered")
+	assert.Equal(t, shared.ChainHandledStateThen, state, "condition hit")
+
+	state = If(
+		Contains("Photo", event.OnNodeCreated()),
+	).Then(func(_ *shared.HandlerContext) error {
+		return nil
+	}).Catch(func(err error) {
+		handledError = err
+	}).Execute(nil, txCtx)
+	assert.Equal(t, shared.ChainHandledStateUnhandled, state, "condition missed")
+}
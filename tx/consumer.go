@@ -0,0 +1,207 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/denkhaus/nksh/event"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/juju/errors"
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+)
+
+// message is sent through the loop stream. It either carries an event
+// of the transaction or signals the timeout of the transaction.
+type message struct {
+	Event *shared.EventContext `json:"event,omitempty"`
+	Flush bool                 `json:"flush,omitempty"`
+}
+
+type messageCodec struct{}
+
+func (p *messageCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (p *messageCodec) Decode(data []byte) (interface{}, error) {
+	var m message
+	return &m, json.Unmarshal(data, &m)
+}
+
+func txKey(txID int64) string {
+	return strconv.FormatInt(txID, 10)
+}
+
+// txDeadline returns the deadline of an encoded TransactionContext.
+func txDeadline(value []byte) (time.Time, error) {
+	txCtx, err := new(shared.TransactionContextCodec).Decode(value)
+	if err != nil {
+		return time.Time{}, errors.Annotate(err, "Decode")
+	}
+	return txCtx.(*shared.TransactionContext).Deadline, nil
+}
+
+func collectEvents(ctx goka.Context, msg interface{}, metrics shared.Metrics) error {
+	data, ok := msg.([]byte)
+	if !ok {
+		metrics.DecodeFailed("", ctx.Topic())
+		return errors.Errorf("invalid message type %+v", msg)
+	}
+
+	m, err := new(event.Neo4jMessageCodec).Decode(data)
+	if err != nil {
+		metrics.DecodeFailed("", ctx.Topic())
+		return errors.Annotate(err, "Decode")
+	}
+
+	evt, err := m.(*event.Neo4jMessage).ToContext()
+	if err != nil {
+		metrics.DecodeFailed("", ctx.Topic())
+		return errors.Annotate(err, "ToContext")
+	}
+
+	ctx.Loopback(txKey(evt.TxID), &message{Event: evt})
+	return nil
+}
+
+// handleTransactionEvents collects the events of a transaction in the group table until it is
+// complete or, flushed by a poll, its deadline passed at now.
+func handleTransactionEvents(ctx goka.Context, msg interface{}, now time.Time, timeout time.Duration, d *shared.Deadlines, metrics shared.Metrics, exes ...Executable) error {
+	m, ok := msg.(*message)
+	if !ok {
+		return errors.Errorf("invalid message type %+v", msg)
+	}
+
+	var txCtx *shared.TransactionContext
+	if val := ctx.Value(); val != nil {
+		txCtx = val.(*shared.TransactionContext)
+	}
+
+	if m.Flush {
+		if txCtx == nil {
+			return nil
+		}
+		if txCtx.Deadline.IsZero() || txCtx.Deadline.After(now) {
+			d.Set(ctx.Key(), txCtx.Deadline)
+			return nil
+		}
+		txCtx.TimedOut = true
+	} else {
+		if m.Event == nil {
+			return errors.New("message without event")
+		}
+		if txCtx == nil {
+			txCtx = shared.NewTransactionContext(m.Event.TxID, m.Event.TxEventsCount)
+			if timeout > 0 {
+				txCtx.Deadline = now.Add(timeout)
+			}
+		}
+		if !txCtx.Add(m.Event) {
+			log.Warningf("duplicate event %d in tx %d", m.Event.TxEventID, txCtx.TxID)
+		}
+		if !txCtx.Complete() {
+			ctx.SetValue(txCtx)
+			d.Set(ctx.Key(), txCtx.Deadline)
+			return nil
+		}
+	}
+
+	ctx.Delete()
+	d.Set(ctx.Key(), time.Time{})
+	for _, exe := range exes {
+		start := time.Now()
+		state := exe.Execute(ctx, txCtx)
+		metrics.ChainHandled("", exe.Name(), state, time.Since(start))
+		if state.Failed() {
+			log.Warningf("unhandled tx msg [%s] by chain %s: %+v", state, exe.Name(), txCtx)
+		}
+	}
+
+	return nil
+}
+
+// receives raw neo4j streams messages, executes transaction chains
+func CreateConsumerDefaults(inputStream goka.Stream, timeout time.Duration, execs ...Executable) shared.DispatcherFunc {
+	return CreateConsumer(TransactionGroup, inputStream, timeout, execs...)
+}
+
+// CreateConsumer buffers the events of inputStream by tx_id until the transaction
+// is complete or timeout elapsed, and executes execs on the collected TransactionContext.
+// A timeout <= 0 waits for completion forever. The deadline of a pending transaction is
+// kept with its events in the group table, a poll every PollInterval flushes it once the
+// deadline passed.
+func CreateConsumer(group goka.Group, inputStream goka.Stream, timeout time.Duration, execs ...Executable) shared.DispatcherFunc {
+	return func(ctx context.Context, kServers, zServers []string) func() error {
+		health := shared.RegisterProcessor(ctx, group)
+		prepared := make([]Executable, 0, len(execs))
+		for idx, exe := range execs {
+			prepared = append(prepared, shared.PrepareChain(ctx, nil, idx, exe).(Executable))
+		}
+		metrics := shared.MetricsFromContext(ctx)
+		return func() error {
+			d := shared.NewDeadlines(txDeadline)
+			g := goka.DefineGroup(group,
+				goka.Input(inputStream, new(codec.Bytes), func(ctx goka.Context, msg interface{}) {
+					metrics.MessageConsumed("", inputStream)
+					if err := collectEvents(ctx, msg, metrics); err != nil {
+						log.Error(errors.Annotate(err, "collectEvents"))
+					}
+				}),
+				goka.Loop(new(messageCodec), func(ctx goka.Context, msg interface{}) {
+					if err := handleTransactionEvents(ctx, msg, time.Now(), timeout, d, metrics, prepared...); err != nil {
+						log.Error(errors.Annotate(err, "handleTransactionEvents"))
+					}
+				}),
+				goka.Persist(new(shared.TransactionContextCodec)),
+			)
+
+			tmb := shared.TopicManagerBuilder(ctx, zServers)
+			emitter, err := goka.NewEmitter(kServers,
+				goka.Stream(g.LoopStream().Topic()), new(messageCodec),
+				shared.EmitterOptions(ctx,
+					goka.WithEmitterTopicManagerBuilder(tmb),
+				)...,
+			)
+			if err != nil {
+				return errors.Annotate(err, "NewEmitter")
+			}
+
+			pollCtx, cancel := context.WithCancel(ctx)
+			polled := make(chan struct{})
+			go func() {
+				defer close(polled)
+				d.Poll(pollCtx, PollInterval, func(key string) error {
+					_, err := emitter.Emit(key, &message{Flush: true})
+					return err
+				})
+			}()
+			defer func() {
+				cancel()
+				<-polled
+				if err := emitter.Finish(); err != nil {
+					log.Error(errors.Annotate(err, "Finish"))
+				}
+			}()
+
+			p, err := goka.NewProcessor(kServers, g,
+				shared.ProcessorOptions(ctx,
+					append(d.Options(),
+						goka.WithTopicManagerBuilder(tmb),
+					)...,
+				)...,
+			)
+			if err != nil {
+				return errors.Annotate(err, "NewProcessor")
+			}
+
+			if err := shared.RunProcessor(ctx, health, p); err != nil {
+				return errors.Annotate(err, "RunProcessor")
+			}
+
+			return nil
+		}
+	}
+}
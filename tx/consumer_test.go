@@ -0,0 +1,55 @@
+package tx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/denkhaus/nksh/graphtest"
+	"github.com/denkhaus/nksh/shared"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleTransactionEvents(t *testing.T) {
+	now := time.Now()
+	d := shared.NewDeadlines(txDeadline)
+	metrics := graphtest.NewMetrics()
+	handled := []*shared.TransactionContext{}
+	exe := If(OnTimeout()).Then(func(ctx *shared.HandlerContext) error {
+		handled = append(handled, ctx.TransactionContext)
+		return nil
+	}).Catch(func(err error) {
+		t.Error(err)
+	})
+
+	ctx := graphtest.NewContext("Transaction-loop", txKey(7))
+	evt := &shared.EventContext{TxID: 7, TxEventsCount: 2, NodeID: 1004}
+	assert.NoError(t, handleTransactionEvents(ctx, &message{Event: evt}, now, time.Minute, d, metrics, exe))
+	if assert.NotNil(t, ctx.Value(), "pending") {
+		assert.Equal(t, now.Add(time.Minute), ctx.Value().(*shared.TransactionContext).Deadline, "deadline")
+	}
+
+	value, err := new(shared.TransactionContextCodec).Encode(ctx.Value())
+	assert.NoError(t, err)
+	deadline, err := txDeadline(value)
+	assert.NoError(t, err)
+	assert.True(t, deadline.Equal(now.Add(time.Minute)), "stored deadline")
+
+	assert.NoError(t, handleTransactionEvents(ctx, &message{Flush: true}, now, time.Minute, d, metrics, exe))
+	assert.Empty(t, handled, "not flushed before the deadline")
+	assert.Empty(t, d.Due(now), "nothing due")
+
+	due := d.Due(now.Add(time.Minute))
+	assert.Equal(t, []string{txKey(7)}, due, "due transactions")
+	assert.NoError(t, handleTransactionEvents(ctx, &message{Flush: true}, now.Add(time.Minute), time.Minute, d, metrics, exe))
+	if assert.Len(t, handled, 1, "flushed") {
+		assert.True(t, handled[0].TimedOut, "timed out")
+	}
+	assert.Nil(t, ctx.Value(), "deleted")
+
+	assert.NoError(t, handleTransactionEvents(ctx, &message{Flush: true}, now.Add(time.Minute), time.Minute, d, metrics, exe))
+	assert.Len(t, handled, 1, "flushed once")
+
+	assert.NoError(t, handleTransactionEvents(ctx, &message{Event: evt}, now, 0, d, metrics, exe))
+	assert.True(t, ctx.Value().(*shared.TransactionContext).Deadline.IsZero(), "no deadline without timeout")
+	assert.Empty(t, d.Due(now.Add(time.Hour)), "never due")
+}
@@ -0,0 +1,19 @@
+package tx
+
+import (
+	"time"
+
+	"github.com/lovoo/goka"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	log logrus.FieldLogger = logrus.New().WithField("package", "tx")
+
+	// PollInterval is the interval the transaction consumer flushes timed out transactions in.
+	PollInterval = time.Second
+)
+
+var (
+	TransactionGroup = goka.Group("Transaction") // Neo4jMessages -> Transactions
+)